@@ -0,0 +1,252 @@
+// Package agent brings mode in which gws runs lua scripts sent by coordinator
+// ("gws script -agents") and streams their output and stats back to it.
+//
+// Scripts have access to the system of the agent, so agent listens on the
+// loopback interface by default and serves only coordinators presenting the
+// shared token.
+package agent
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gobwas/gws/agent/proto"
+	"github.com/gobwas/gws/config"
+	"github.com/gobwas/gws/lua"
+	modExecutor "github.com/gobwas/gws/lua/mod/executor"
+	"github.com/gobwas/gws/stat"
+	"github.com/gobwas/gws/ws"
+)
+
+// reportInterval is how often output and stats are sent to coordinator.
+const reportInterval = 250 * time.Millisecond
+
+// defaultAddr is an address to listen unless -listen flag is given.
+const defaultAddr = "127.0.0.1:3000"
+
+func Go(c config.Config) error {
+	if *proto.Token == "" {
+		return fmt.Errorf("agent requires -agent-token shared with coordinator")
+	}
+	if !isFlagSet("listen") {
+		c.Addr = defaultAddr
+	}
+	upgrade := ws.GetUpgrader(ws.UpgradeConfig{})
+	busy := make(chan struct{}, 1)
+
+	log.Printf("agent is ready to listen %s", c.Addr)
+	return http.ListenAndServe(c.Addr, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !proto.Authorized(r, *proto.Token) {
+			log.Printf("coordinator %s is not authorized", r.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="gws"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		// Agent runs one script at a time.
+		select {
+		case busy <- struct{}{}:
+			defer func() { <-busy }()
+		default:
+			http.Error(w, "agent is busy", http.StatusServiceUnavailable)
+			return
+		}
+
+		wsConn, err := upgrade(w, r)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		conn := proto.NewConn(wsConn)
+		defer conn.Close()
+
+		log.Printf("coordinator %s connected", r.RemoteAddr)
+		if err := serve(conn, c); err != nil {
+			log.Printf("coordinator %s error: %s", r.RemoteAddr, err)
+		}
+		log.Printf("coordinator %s done", r.RemoteAddr)
+	}))
+}
+
+func serve(conn *proto.Conn, c config.Config) error {
+	prepare, err := conn.Receive()
+	if err != nil {
+		return err
+	}
+	if prepare.Type != proto.TypePrepare {
+		return fmt.Errorf("unexpected %q message", prepare.Type)
+	}
+
+	// Script and modules are written to files to let the script read files
+	// relative to its directory and require modules. Directory of the k-th
+	// lua path entry is k-th subdirectory.
+	dir, err := ioutil.TempDir("", "gws-agent")
+	if err != nil {
+		return fail(conn, err)
+	}
+	defer os.RemoveAll(dir)
+	modules := prepare.Modules
+	if len(modules) == 0 {
+		modules = []map[string]string{nil}
+	}
+	var luaPath []string
+	for i, files := range modules {
+		d := filepath.Join(dir, strconv.Itoa(i))
+		if err := os.Mkdir(d, 0755); err != nil {
+			return fail(conn, err)
+		}
+		for name, data := range files {
+			if err := writeFile(d, name, data); err != nil {
+				return fail(conn, err)
+			}
+		}
+		if i > 0 {
+			luaPath = append(luaPath, d)
+		}
+	}
+	name := filepath.Base(prepare.Name)
+	if err := writeFile(filepath.Join(dir, "0"), name, prepare.Script); err != nil {
+		return fail(conn, err)
+	}
+	path := filepath.Join(dir, "0", name)
+	if err := conn.Send(proto.Message{Type: proto.TypeReady}); err != nil {
+		return err
+	}
+
+	start, err := conn.Receive()
+	if err != nil {
+		return err
+	}
+	if start.Type != proto.TypeStart {
+		return nil
+	}
+	time.Sleep(time.Until(time.Unix(0, start.At)))
+
+	// Script is stopped when coordinator asks for it or goes away.
+	stop := make(chan struct{})
+	go func() {
+		for {
+			m, err := conn.Receive()
+			if err != nil || m.Type == proto.TypeStop {
+				close(stop)
+				return
+			}
+		}
+	}()
+
+	if prepare.URL != "" {
+		c.URI = prepare.URL
+	}
+	stats := stat.New()
+	output := &buffer{}
+	done := make(chan error, 1)
+	go func() {
+		done <- lua.Run(c, lua.Job{
+			Path:   path,
+			Code:   prepare.Script,
+			Args:   prepare.Args,
+			Part:   modExecutor.Share{Index: prepare.Index, Count: prepare.Count},
+			Stats:  stats,
+			Output: output,
+			Stop:   stop,
+
+			LuaPath: luaPath,
+			Settings: lua.Settings{
+				Coroutine:   prepare.Coroutine,
+				OnError:     prepare.OnError,
+				Seed:        prepare.Seed,
+				VirtualTime: prepare.VirtualTime,
+			},
+		})
+	}()
+
+	report := func() error {
+		return conn.Send(proto.Message{
+			Type:    proto.TypeReport,
+			Output:  output.flush(),
+			Results: stats.Results(),
+		})
+	}
+	ticker := time.NewTicker(reportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := report(); err != nil {
+				<-done
+				return err
+			}
+
+		case err := <-done:
+			if err := report(); err != nil {
+				return err
+			}
+			if err != nil {
+				return fail(conn, err)
+			}
+			return conn.Send(proto.Message{Type: proto.TypeDone})
+		}
+	}
+}
+
+// writeFile writes file with slash separated path relative to dir. Paths
+// leading out of dir are refused.
+func writeFile(dir, name, data string) error {
+	rel := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(rel) || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("invalid file name: %q", name)
+	}
+	path := filepath.Join(dir, rel)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, []byte(data), 0644)
+}
+
+// isFlagSet reports whether the flag with given name is given in command line.
+func isFlagSet(name string) (set bool) {
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return
+}
+
+// fail sends done message with error to coordinator.
+func fail(conn *proto.Conn, err error) error {
+	conn.Send(proto.Message{
+		Type:  proto.TypeDone,
+		Error: err.Error(),
+	})
+	return err
+}
+
+// buffer collects output of the script between reports.
+type buffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *buffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *buffer) flush() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.buf.String()
+	b.buf.Reset()
+	return s
+}
@@ -0,0 +1,108 @@
+// Package proto brings messages exchanged between coordinator and agents.
+//
+// Coordinator sends "prepare" message with the script to every agent and
+// waits for "ready" replies. Then it sends "start" message with the same
+// start time to all of them. Agents periodically send "report" messages with
+// output and stats of the script, and "done" message when it finishes.
+// Coordinator may send "stop" message to stop the script softly.
+//
+// Coordinator authorizes itself on handshake with the token shared with
+// agents.
+package proto
+
+import (
+	"crypto/subtle"
+	"flag"
+	"net/http"
+	"sync"
+
+	"github.com/gobwas/gws/stat/results"
+	"github.com/gorilla/websocket"
+)
+
+// Token is a secret shared by coordinator and agents.
+var Token = flag.String("agent-token", "", "secret token which coordinator presents to agents on handshake (required by agent)")
+
+const (
+	TypePrepare = "prepare"
+	TypeReady   = "ready"
+	TypeStart   = "start"
+	TypeReport  = "report"
+	TypeStop    = "stop"
+	TypeDone    = "done"
+)
+
+type Message struct {
+	Type string `json:"type"`
+
+	// Prepare fields. Index and Count describe part of the executor load
+	// given to the agent.
+	Name   string            `json:"name,omitempty"`
+	Script string            `json:"script,omitempty"`
+	Args   map[string]string `json:"args,omitempty"`
+	URL    string            `json:"url,omitempty"`
+	Index  int               `json:"index,omitempty"`
+	Count  int               `json:"count,omitempty"`
+
+	// Modules are lua files which the script could require, one map of
+	// slash separated relative paths to contents per directory of lua path.
+	// The first one is the script directory.
+	Modules []map[string]string `json:"modules,omitempty"`
+
+	// Settings of the run given to coordinator by flags.
+	Coroutine   bool   `json:"coroutine,omitempty"`
+	OnError     string `json:"onError,omitempty"`
+	Seed        int64  `json:"seed,omitempty"`
+	VirtualTime bool   `json:"virtualTime,omitempty"`
+
+	// At is a start time in unix nanoseconds.
+	At int64 `json:"at,omitempty"`
+
+	// Report fields. Results are current values of all counters.
+	Output  string           `json:"output,omitempty"`
+	Results []results.Result `json:"results,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// Header returns handshake headers which present the token to agent.
+func Header(token string) http.Header {
+	h := http.Header{}
+	if token != "" {
+		h.Set("Authorization", "Bearer "+token)
+	}
+	return h
+}
+
+// Authorized checks that handshake request presents the token.
+func Authorized(r *http.Request, token string) bool {
+	got := r.Header.Get("Authorization")
+	want := "Bearer " + token
+	return token != "" && subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
+
+// Conn is a websocket connection which could be written from multiple
+// goroutines.
+type Conn struct {
+	mu   sync.Mutex
+	conn *websocket.Conn
+}
+
+func NewConn(conn *websocket.Conn) *Conn {
+	return &Conn{conn: conn}
+}
+
+func (c *Conn) Send(m Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn.WriteJSON(m)
+}
+
+func (c *Conn) Receive() (m Message, err error) {
+	err = c.conn.ReadJSON(&m)
+	return
+}
+
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
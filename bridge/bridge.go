@@ -0,0 +1,179 @@
+// Package bridge brings tools for tunneling tcp or stdio through websocket.
+package bridge
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gobwas/gws/config"
+	"github.com/gobwas/gws/ws"
+	"github.com/gorilla/websocket"
+)
+
+var (
+	tcpListen = flag.String("tcp-listen", "", "tcp address to listen in bridge mode; every accepted connection is tunneled to -url websocket")
+	tcpDial   = flag.String("tcp-dial", "", "tcp address to dial in bridge mode; every websocket connection accepted on -listen is tunneled to it")
+)
+
+// chunkSize is a maximum size of binary message made from bytes read from
+// tcp or stdio.
+const chunkSize = 32 << 10
+
+// closeTimeout is a time to wait for the other side to close connection after
+// the local side is done.
+const closeTimeout = 5 * time.Second
+
+func Go(c config.Config) error {
+	switch {
+	case *tcpListen != "" && *tcpDial != "":
+		return errors.New("bridge: only one of -tcp-listen and -tcp-dial could be used")
+
+	case *tcpListen != "":
+		return listenTCP(*tcpListen, c)
+
+	case *tcpDial != "":
+		return listenWS(c.Addr, *tcpDial, c)
+
+	default:
+		conn, _, err := ws.GetConn(c.URI, c.Headers)
+		if err != nil {
+			return err
+		}
+		log.Printf("bridging stdio with %s", c.URI)
+		return pipe(conn, stdio{})
+	}
+}
+
+// listenTCP accepts tcp connections and tunnels each to the websocket
+// endpoint.
+func listenTCP(addr string, c config.Config) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("ready to listen tcp %s and bridge to %s", addr, c.URI)
+
+	for {
+		tcp, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer tcp.Close()
+
+			conn, _, err := ws.GetConn(c.URI, c.Headers)
+			if err != nil {
+				log.Printf("could not connect to %s: %s", c.URI, err)
+				return
+			}
+			log.Printf("bridging %s with %s", tcp.RemoteAddr(), c.URI)
+			if err := pipe(conn, tcp); err != nil {
+				log.Printf("bridge %s error: %s", tcp.RemoteAddr(), err)
+			}
+			log.Printf("bridge %s closed", tcp.RemoteAddr())
+		}()
+	}
+}
+
+// listenWS accepts websocket connections and tunnels each to the tcp target.
+func listenWS(addr, target string, c config.Config) error {
+	upgrade := ws.GetUpgrader(ws.UpgradeConfig{Headers: c.Headers})
+
+	log.Printf("ready to listen websocket %s and bridge to tcp %s", addr, target)
+	return http.ListenAndServe(addr, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tcp, err := net.Dial("tcp", target)
+		if err != nil {
+			log.Printf("could not connect to %s: %s", target, err)
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer tcp.Close()
+
+		conn, err := upgrade(w, r)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		log.Printf("bridging %s with tcp %s", r.RemoteAddr, target)
+		if err := pipe(conn, tcp); err != nil {
+			log.Printf("bridge %s error: %s", r.RemoteAddr, err)
+		}
+		log.Printf("bridge %s closed", r.RemoteAddr)
+	}))
+}
+
+// pipe copies bytes from rw as binary messages to conn and data of messages
+// from conn to rw until one of them is closed. It closes conn before return.
+func pipe(conn *websocket.Conn, rw io.ReadWriter) error {
+	defer conn.Close()
+
+	received := make(chan error, 1)
+	go func() {
+		for {
+			msg, err := ws.ReadFromConn(conn)
+			if err != nil {
+				if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+					err = nil
+				}
+				received <- err
+				return
+			}
+			if _, err := rw.Write(msg.Data); err != nil {
+				received <- err
+				return
+			}
+		}
+	}()
+
+	sent := make(chan error, 1)
+	go func() {
+		buf := make([]byte, chunkSize)
+		for {
+			n, err := rw.Read(buf)
+			if n > 0 {
+				if err := ws.WriteToConn(conn, ws.BinaryMessage, buf[:n]); err != nil {
+					sent <- err
+					return
+				}
+			}
+			if err != nil {
+				sent <- err
+				return
+			}
+		}
+	}()
+
+	select {
+	case err := <-received:
+		return err
+
+	case err := <-sent:
+		if err != io.EOF {
+			return err
+		}
+		// Start closing handshake and wait for the rest of messages until
+		// the other side closes connection.
+		conn.WriteControl(
+			websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+			time.Now().Add(time.Second),
+		)
+		select {
+		case err := <-received:
+			return err
+		case <-time.After(closeTimeout):
+			return nil
+		}
+	}
+}
+
+type stdio struct{}
+
+func (stdio) Read(p []byte) (int, error)  { return os.Stdin.Read(p) }
+func (stdio) Write(p []byte) (int, error) { return os.Stdout.Write(p) }
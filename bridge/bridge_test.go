@@ -0,0 +1,118 @@
+package bridge
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gobwas/gws/ws"
+	"github.com/gorilla/websocket"
+)
+
+// startBridge starts websocket server which pipes every connection with one
+// end of net.Pipe, like the -tcp-dial mode does with tcp target. It returns
+// connected websocket client, the other end of the pipe and channel receiving
+// the pipe() result.
+func startBridge(t *testing.T) (*websocket.Conn, net.Conn, <-chan error) {
+	local, remote := net.Pipe()
+	done := make(chan error, 1)
+	upgrade := ws.GetUpgrader(ws.UpgradeConfig{Origin: "*"})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer local.Close()
+		conn, err := upgrade(w, r)
+		if err != nil {
+			done <- err
+			return
+		}
+		done <- pipe(conn, local)
+	}))
+	t.Cleanup(srv.Close)
+
+	conn, _, err := ws.GetConn("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn, remote, done
+}
+
+func waitPipe(t *testing.T, done <-chan error) {
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("pipe() error: %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("pipe() is not finished")
+	}
+}
+
+func TestPipeData(t *testing.T) {
+	conn, tcp, _ := startBridge(t)
+	defer tcp.Close()
+
+	// Data of both text and binary messages is written to tcp as is.
+	for _, msg := range []ws.MessageRaw{
+		{Kind: ws.TextMessage, Data: []byte("hello")},
+		{Kind: ws.BinaryMessage, Data: []byte{0, 1, 2}},
+	} {
+		if err := ws.WriteToConn(conn, msg.Kind, msg.Data); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, len(msg.Data))
+		if _, err := io.ReadFull(tcp, buf); err != nil {
+			t.Fatal(err)
+		}
+		if string(buf) != string(msg.Data) {
+			t.Errorf("tcp got %q from %v message; want %q", buf, msg.Kind, msg.Data)
+		}
+	}
+
+	// Bytes from tcp are sent as binary messages.
+	if _, err := tcp.Write([]byte("world")); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := ws.ReadFromConn(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Kind != ws.BinaryMessage || string(msg.Data) != "world" {
+		t.Errorf("websocket got %v %q; want %v %q", msg.Kind, msg.Data, ws.BinaryMessage, "world")
+	}
+}
+
+func TestPipeCloseTCP(t *testing.T) {
+	conn, tcp, done := startBridge(t)
+
+	// Closed tcp starts closing handshake with normal closure.
+	tcp.Close()
+	_, err := ws.ReadFromConn(conn)
+	if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Errorf("websocket read error is %v; want normal closure", err)
+	}
+	waitPipe(t, done)
+}
+
+func TestPipeCloseWebsocket(t *testing.T) {
+	conn, tcp, done := startBridge(t)
+	defer tcp.Close()
+
+	err := conn.WriteMessage(
+		websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitPipe(t, done)
+
+	// Tcp is closed after websocket.
+	tcp.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := tcp.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("tcp read error is %v; want %v", err, io.EOF)
+	}
+}
@@ -16,7 +16,7 @@ func NewPrefixWriter(dest io.Writer, prefix string) *PrefixWriter {
 
 // Write writes p into underlying writer with prefix.
 func (w PrefixWriter) Write(p []byte) (int, error) {
-	ret := make([]byte, len(p)+len(w.prefix))
+	ret := make([]byte, 0, len(p)+len(w.prefix))
 	ret = append(ret, w.prefix...)
 	ret = append(ret, p...)
 	return w.dest.Write(ret)
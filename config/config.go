@@ -26,8 +26,8 @@ func init() {
 	flag.StringVar(&Addr, "listen", ":3000", "address to listen")
 	flag.StringVar(&URI, "url", ":3000", "address to connect")
 	flag.DurationVar(&Stat, "statd", time.Second, "server statistics dump interval")
-	flag.Var(HeaderList, "header", fmt.Sprintf("allows to specify list of headers to be passed during handshake (both in client or server)\n\tformat:\n\t\t{ key %s value }", headers.AssignmentOperator))
-	flag.Var(HeaderList, "H", fmt.Sprintf("allows to specify list of headers to be passed during handshake (both in client or server)\n\tformat:\n\t\t{ key %s value }", headers.AssignmentOperator))
+	flag.Var(HeaderList, "header", fmt.Sprintf("allows to specify list of headers to be passed during handshake (both in client or server)\n\tformat:\n\t\t{ key %c value }", headers.AssignmentOperator))
+	flag.Var(HeaderList, "H", fmt.Sprintf("allows to specify list of headers to be passed during handshake (both in client or server)\n\tformat:\n\t\t{ key %c value }", headers.AssignmentOperator))
 }
 
 type headerList struct {
@@ -0,0 +1,56 @@
+package ev
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is a source of loop time.
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+// RealClock returns clock which reports the system time.
+func RealClock() Clock {
+	return realClock{}
+}
+
+// VirtualClock is a clock which time moves only when told to. Loop with
+// virtual clock jumps to the nearest timer deadline when it has no events and
+// requests to process, so timers fire instantly and in deterministic order.
+type VirtualClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func NewVirtualClock(start time.Time) *VirtualClock {
+	return &VirtualClock{now: start}
+}
+
+func (c *VirtualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves clock forward by d.
+func (c *VirtualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if d > 0 {
+		c.now = c.now.Add(d)
+	}
+}
+
+// advanceTo moves clock forward to t. It does nothing if t is in the past.
+func (c *VirtualClock) advanceTo(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if t.After(c.now) {
+		c.now = t
+	}
+}
@@ -0,0 +1,39 @@
+package ev
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestVirtualClockTimers(t *testing.T) {
+	start := time.Unix(0, 0)
+	loop := NewLoop()
+	loop.SetClock(NewVirtualClock(start))
+
+	var fired []time.Duration
+	record := func() {
+		fired = append(fired, loop.Now().Sub(start))
+	}
+	loop.Timeout(time.Hour, false, record)
+	loop.Timeout(time.Minute, false, func() {
+		record()
+		loop.Timeout(time.Minute, false, record)
+	})
+
+	begin := time.Now()
+	loop.Run()
+	select {
+	case <-loop.Done():
+	case <-time.After(time.Second * 5):
+		t.Fatal("loop is not done")
+	}
+	if elapsed := time.Since(begin); elapsed > time.Second {
+		t.Errorf("loop with virtual clock took %s", elapsed)
+	}
+
+	exp := []time.Duration{time.Minute, 2 * time.Minute, time.Hour}
+	if !reflect.DeepEqual(fired, exp) {
+		t.Errorf("timers fired at %v; want %v", fired, exp)
+	}
+}
@@ -16,6 +16,13 @@ type Handler interface {
 	Stop()
 }
 
+// BusyHandler is implemented by handlers which could have operations in
+// progress that complete on their own, like dialing or sending. Loop with
+// virtual clock does not move time while any of them is busy.
+type BusyHandler interface {
+	IsBusy(*Loop) bool
+}
+
 type Loop struct {
 	mu sync.Mutex
 
@@ -25,10 +32,14 @@ type Loop struct {
 	teardowns []event
 	timers    []*Timer
 	now       time.Time
+	clock     Clock
+	idleSince time.Time
 	done      chan struct{}
 	shutdown  chan struct{}
 	stop      chan struct{}
+	wake      chan struct{}
 	locked    bool
+	refs      int
 	//	idles    []Idle
 }
 
@@ -37,11 +48,30 @@ func NewLoop() *Loop {
 		done:     make(chan struct{}),
 		shutdown: make(chan struct{}),
 		stop:     make(chan struct{}, 1),
+		wake:     make(chan struct{}, 1),
 		handlers: make(map[RequestType][]Handler),
 		now:      time.Now(),
+		clock:    RealClock(),
 	}
 }
 
+// SetClock sets source of loop time. It must be called before Run.
+func (l *Loop) SetClock(c Clock) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.clock = c
+	l.now = c.Now()
+}
+
+func (l *Loop) Clock() Clock {
+	return l.clock
+}
+
+// Now returns current time of the loop clock.
+func (l *Loop) Now() time.Time {
+	return l.clock.Now()
+}
+
 func (l *Loop) Register(h Handler, t RequestType) {
 	l.handlers[t] = append(l.handlers[t], h)
 	if err := h.Init(l); err != nil {
@@ -61,6 +91,7 @@ func (l *Loop) Request(t RequestType, data interface{}, cb Callback) error {
 		}
 	}
 	l.mu.Unlock()
+	l.signal()
 	return nil
 }
 
@@ -72,6 +103,7 @@ func (l *Loop) Call(cb event) {
 		}
 	}
 	l.mu.Unlock()
+	l.signal()
 }
 
 func (l *Loop) Timeout(delay time.Duration, repeat bool, cb event) *Timer {
@@ -89,10 +121,26 @@ func (l *Loop) Timeout(delay time.Duration, repeat bool, cb event) *Timer {
 		}
 	}
 	l.mu.Unlock()
+	l.signal()
 
 	return timer
 }
 
+// Ref makes loop to be alive until Unref is called.
+func (l *Loop) Ref() {
+	l.mu.Lock()
+	l.refs++
+	l.mu.Unlock()
+}
+
+// Unref releases reference made by Ref.
+func (l *Loop) Unref() {
+	l.mu.Lock()
+	l.refs--
+	l.mu.Unlock()
+	l.signal()
+}
+
 func (l *Loop) Teardown(cb event) {
 	l.mu.Lock()
 	{
@@ -109,8 +157,22 @@ func (l *Loop) Shutdown() {
 	close(l.shutdown)
 }
 
+// Stop stops timers and handlers of the loop. It does not block, so it could
+// be called multiple times, from the loop callbacks or after the loop is done.
 func (l *Loop) Stop() {
-	l.stop <- struct{}{}
+	select {
+	case l.stop <- struct{}{}:
+	default:
+	}
+	l.signal()
+}
+
+// signal wakes up the loop waiting in idle state.
+func (l *Loop) signal() {
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
 }
 
 func (l *Loop) lock() {
@@ -143,6 +205,13 @@ func (l *Loop) Run() error {
 						close(l.done)
 						return
 					}
+				} else if l.isIdle() {
+					// Loop is alive only because of references, so wait
+					// for something to do instead of spinning.
+					select {
+					case <-l.wake:
+					case <-l.shutdown:
+					}
 				} else {
 					l.updateNow()
 					l.drainTimers()
@@ -150,6 +219,7 @@ func (l *Loop) Run() error {
 
 					l.nextEvent()
 					l.nextRequest()
+					l.skipIdle()
 				}
 			}
 		}
@@ -171,6 +241,9 @@ func (l *Loop) IsAlive() bool {
 	if len(l.timers) > 0 {
 		return true
 	}
+	if l.refs > 0 && !l.locked {
+		return true
+	}
 	//	if l.locked {
 	//		return false
 	//	}
@@ -186,8 +259,83 @@ func (l *Loop) IsAlive() bool {
 	return false
 }
 
+// isIdle reports whether loop has no events, requests, timers and active
+// handlers.
+func (l *Loop) isIdle() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.requests) > 0 || len(l.events) > 0 || len(l.timers) > 0 {
+		return false
+	}
+	for _, handlers := range l.handlers {
+		for _, handler := range handlers {
+			if handler.IsActive(l) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 func (l *Loop) updateNow() {
-	l.now = time.Now()
+	l.mu.Lock()
+	l.now = l.clock.Now()
+	l.mu.Unlock()
+}
+
+// virtualIdle is a real time loop with virtual clock must have nothing to do
+// before jumping to the next timer. It gives results of network operations a
+// chance to arrive.
+const virtualIdle = time.Millisecond * 5
+
+// skipIdle moves virtual clock to the nearest timer deadline if loop has no
+// events and requests to process.
+func (l *Loop) skipIdle() {
+	vc, ok := l.clock.(*VirtualClock)
+	if !ok {
+		return
+	}
+
+	var next time.Time
+	l.mu.Lock()
+	{
+		if len(l.events) > 0 || len(l.requests) > 0 {
+			l.idleSince = time.Time{}
+			l.mu.Unlock()
+			return
+		}
+		if l.idleSince.IsZero() {
+			l.idleSince = time.Now()
+		}
+		if time.Since(l.idleSince) < virtualIdle {
+			l.mu.Unlock()
+			// Let goroutines doing i/o to deliver their results. Sleep
+			// instead of runtime.Gosched() makes scheduler to poll network
+			// even when there is only one processor.
+			time.Sleep(virtualIdle / 50)
+			return
+		}
+		l.idleSince = time.Time{}
+		for _, handlers := range l.handlers {
+			for _, h := range handlers {
+				if b, ok := h.(BusyHandler); ok && b.IsBusy(l) {
+					l.mu.Unlock()
+					return
+				}
+			}
+		}
+		for _, t := range l.timers {
+			if !t.dropped && (next.IsZero() || t.next.Before(next)) {
+				next = t.next
+			}
+		}
+	}
+	l.mu.Unlock()
+
+	if !next.IsZero() {
+		vc.advanceTo(next)
+	}
 }
 
 func (l *Loop) stopHandlers() {
@@ -223,7 +371,7 @@ func (l *Loop) drainTimers() {
 			case t.dropped:
 				remove = true
 
-			case t.next.Before(l.now):
+			case !t.next.After(l.now):
 				callbacks = append(callbacks, t.cb)
 
 				if t.repeat {
@@ -248,7 +396,7 @@ func (l *Loop) drainTimers() {
 }
 
 func (l *Loop) deleteTimer(i int) {
-	copy(l.timers, l.timers[i+1:])
+	copy(l.timers[i:], l.timers[i+1:])
 	last := len(l.timers) - 1
 	l.timers[last] = nil
 	l.timers = l.timers[:last]
@@ -0,0 +1,94 @@
+package ev
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLoopTimeoutDeleteKeepsOthers(t *testing.T) {
+	loop := NewLoop()
+	loop.SetClock(NewVirtualClock(time.Unix(0, 0)))
+
+	var ticks, fired int
+	var interval *Timer
+	interval = loop.Timeout(time.Second, true, func() {
+		if ticks++; ticks == 3 {
+			interval.Stop()
+		}
+	})
+	loop.Timeout(time.Millisecond, false, func() { fired++ })
+	loop.Timeout(time.Millisecond*2, false, func() { fired++ })
+
+	loop.Run()
+	select {
+	case <-loop.Done():
+	case <-time.After(time.Second * 5):
+		t.Fatal("loop is not done")
+	}
+	if ticks != 3 || fired != 2 {
+		t.Errorf("got %d ticks and %d fired timeouts; want 3 and 2", ticks, fired)
+	}
+}
+
+func TestLoopStopTwice(t *testing.T) {
+	loop := NewLoop()
+	loop.Timeout(time.Millisecond, false, func() {
+		loop.Stop()
+		loop.Stop()
+	})
+
+	loop.Run()
+	select {
+	case <-loop.Done():
+	case <-time.After(time.Second * 5):
+		t.Fatal("loop is not done")
+	}
+	loop.Stop()
+}
+
+// countClock counts reads of the time.
+type countClock struct {
+	reads int32
+}
+
+func (c *countClock) Now() time.Time {
+	atomic.AddInt32(&c.reads, 1)
+	return time.Now()
+}
+
+func TestLoopIdleRef(t *testing.T) {
+	loop := NewLoop()
+	clock := &countClock{}
+	loop.SetClock(clock)
+	loop.Ref()
+	loop.Run()
+
+	// Loop kept only by reference waits instead of spinning.
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt32(&clock.reads); n > 10 {
+		t.Errorf("idle loop read the clock %d times", n)
+	}
+
+	called := make(chan struct{})
+	loop.Call(func() { close(called) })
+	select {
+	case <-called:
+	case <-time.After(time.Second * 5):
+		t.Fatal("idle loop does not call callback")
+	}
+	fired := make(chan struct{})
+	loop.Timeout(time.Millisecond, false, func() { close(fired) })
+	select {
+	case <-fired:
+	case <-time.After(time.Second * 5):
+		t.Fatal("idle loop does not fire timer")
+	}
+
+	loop.Unref()
+	select {
+	case <-loop.Done():
+	case <-time.After(time.Second * 5):
+		t.Fatal("loop is not done after unref")
+	}
+}
@@ -0,0 +1,147 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gobwas/gws/ev"
+	"github.com/gobwas/gws/ws"
+)
+
+type Request struct {
+	Method  string
+	Url     string
+	Headers http.Header
+	Body    []byte
+	Timeout time.Duration
+	Jar     http.CookieJar
+}
+
+type Response struct {
+	Status  int
+	Headers http.Header
+	Body    []byte
+}
+
+var (
+	transportOnce sync.Once
+	transport     *http.Transport
+)
+
+func getTransport() *http.Transport {
+	transportOnce.Do(func() {
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = ws.TLSClientConfig()
+	})
+	return transport
+}
+
+// Do makes request synchronously.
+func Do(req Request) (*Response, error) {
+	return do(context.Background(), req)
+}
+
+func do(ctx context.Context, req Request) (*Response, error) {
+	var body io.Reader
+	if req.Body != nil {
+		body = bytes.NewReader(req.Body)
+	}
+	r, err := http.NewRequestWithContext(ctx, req.Method, req.Url, body)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range req.Headers {
+		r.Header[key] = values
+	}
+	if host := r.Header.Get("Host"); host != "" {
+		r.Host = host
+	}
+
+	client := &http.Client{
+		Transport: getTransport(),
+		Timeout:   req.Timeout,
+		Jar:       req.Jar,
+	}
+	resp, err := client.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Response{
+		Status:  resp.StatusCode,
+		Headers: resp.Header,
+		Body:    data,
+	}, nil
+}
+
+type Handler struct {
+	pending int32
+	loops   int32
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+func NewHandler() *Handler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Handler{
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+func (h *Handler) Init(*ev.Loop) error {
+	if atomic.SwapInt32(&h.loops, 1) >= 1 {
+		return fmt.Errorf("http handler could be registered only in one loop")
+	}
+	return nil
+}
+
+func (h *Handler) Handle(loop *ev.Loop, data interface{}, cb ev.Callback) error {
+	req, ok := data.(Request)
+	if !ok {
+		return fmt.Errorf("unknown request format to http handler: %s", data)
+	}
+
+	atomic.AddInt32(&h.pending, 1)
+	go func() {
+		resp, err := do(h.ctx, req)
+		if err != nil {
+			loop.Call(func() {
+				cb(err, nil)
+			})
+		} else {
+			loop.Call(func() {
+				cb(nil, resp)
+			})
+		}
+		atomic.AddInt32(&h.pending, -1)
+	}()
+
+	return nil
+}
+
+// Stop cancels all pending requests.
+func (h *Handler) Stop() {
+	h.cancel()
+}
+
+func (h *Handler) IsActive(loop *ev.Loop) bool {
+	return atomic.LoadInt32(&h.pending) > 0
+}
+
+func (h *Handler) IsBusy(loop *ev.Loop) bool {
+	return h.IsActive(loop)
+}
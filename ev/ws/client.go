@@ -12,6 +12,7 @@ import (
 type Connect struct {
 	Url     string
 	Headers http.Header
+	Jar     http.CookieJar
 }
 
 type Send struct {
@@ -23,6 +24,11 @@ type Receive struct {
 	conn *ws.Connection
 }
 
+// ReceiveOnce requests a single message from connection.
+type ReceiveOnce struct {
+	Conn *ws.Connection
+}
+
 func NewReceive(c *ws.Connection) *Receive {
 	return &Receive{
 		conn: c,
@@ -32,6 +38,7 @@ func NewReceive(c *ws.Connection) *Receive {
 type ClientHandler struct {
 	mu      sync.Mutex
 	pending int32
+	busy    int32 // connects and sends in progress
 	loops   int32
 	stop    chan struct{}
 }
@@ -60,6 +67,9 @@ func (h *ClientHandler) Handle(loop *ev.Loop, data interface{}, cb ev.Callback)
 	case *Receive:
 		h.doReceive(loop, v, cb)
 
+	case ReceiveOnce:
+		h.doReceiveOnce(loop, v, cb)
+
 	default:
 		return fmt.Errorf("unknown request format to ws handler: %s", data)
 	}
@@ -75,10 +85,18 @@ func (h *ClientHandler) IsActive(loop *ev.Loop) bool {
 	return atomic.LoadInt32(&h.pending) > 0
 }
 
+// IsBusy reports whether there are connects or sends in progress. Receives
+// are not counted, because they depend on the other side.
+func (h *ClientHandler) IsBusy(loop *ev.Loop) bool {
+	return atomic.LoadInt32(&h.busy) > 0
+}
+
 func (h *ClientHandler) doConnect(loop *ev.Loop, req Connect, cb ev.Callback) {
 	atomic.AddInt32(&h.pending, 1)
+	atomic.AddInt32(&h.busy, 1)
 	go func() {
-		conn, _, err := ws.GetConn(req.Url, req.Headers)
+		defer atomic.AddInt32(&h.busy, -1)
+		conn, _, err := ws.GetConnWithJar(req.Url, req.Headers, req.Jar)
 		if err != nil {
 			loop.Call(func() {
 				cb(err, nil)
@@ -94,7 +112,9 @@ func (h *ClientHandler) doConnect(loop *ev.Loop, req Connect, cb ev.Callback) {
 
 func (h *ClientHandler) doSend(loop *ev.Loop, req Send, cb ev.Callback) {
 	atomic.AddInt32(&h.pending, 1)
+	atomic.AddInt32(&h.busy, 1)
 	go func() {
+		defer atomic.AddInt32(&h.busy, -1)
 		err := req.Conn.Send(req.Message)
 		if err != nil {
 			loop.Call(func() {
@@ -109,6 +129,17 @@ func (h *ClientHandler) doSend(loop *ev.Loop, req Send, cb ev.Callback) {
 	}()
 }
 
+func (h *ClientHandler) doReceiveOnce(loop *ev.Loop, req ReceiveOnce, cb ev.Callback) {
+	atomic.AddInt32(&h.pending, 1)
+	go func() {
+		msg, err := req.Conn.Receive()
+		loop.Call(func() {
+			cb(err, msg)
+		})
+		atomic.AddInt32(&h.pending, -1)
+	}()
+}
+
 func (h *ClientHandler) doReceive(loop *ev.Loop, req *Receive, cb ev.Callback) {
 	atomic.AddInt32(&h.pending, 1)
 	go func() {
@@ -131,7 +162,7 @@ func (h *ClientHandler) doReceive(loop *ev.Loop, req *Receive, cb ev.Callback) {
 				}
 
 				loop.Call(func() {
-					cb(nil, string(msg.Data))
+					cb(nil, msg)
 				})
 			}
 		}
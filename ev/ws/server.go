@@ -56,6 +56,20 @@ func (h *ServerHandler) IsActive(loop *ev.Loop) bool {
 	return h.getPending(loop) > 0
 }
 
+// IsBusy reports whether some server has not started to listen yet.
+func (h *ServerHandler) IsBusy(loop *ev.Loop) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, desc := range h.servers {
+		select {
+		case <-desc.server.Ready():
+		default:
+			return true
+		}
+	}
+	return false
+}
+
 func (h *ServerHandler) doListen(loop *ev.Loop, cfg ws.ServerConfig, cb ev.Callback) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
@@ -3,10 +3,13 @@ package main
 import (
 	"flag"
 	"fmt"
+	"github.com/gobwas/gws/agent"
+	"github.com/gobwas/gws/bridge"
 	"github.com/gobwas/gws/cli/color"
 	"github.com/gobwas/gws/client"
 	"github.com/gobwas/gws/config"
 	"github.com/gobwas/gws/lua"
+	"github.com/gobwas/gws/proxy"
 	"github.com/gobwas/gws/server"
 	"io"
 	"os"
@@ -17,14 +20,17 @@ const (
 	modeServer = "server"
 	modeClient = "client"
 	modeScript = "script"
+	modeProxy  = "proxy"
+	modeBridge = "bridge"
+	modeAgent  = "agent"
 )
 
-var modes = []string{modeServer, modeClient, modeScript}
+var modes = []string{modeClient, modeServer, modeScript, modeProxy, modeBridge, modeAgent}
 
 func main() {
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage of %s:\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "%s %s|%s|%s [options]\n", os.Args[0], modeClient, modeServer, modeScript)
+		fmt.Fprintf(os.Stderr, "%s %s [options]\n", os.Args[0], strings.Join(modes, "|"))
 		fmt.Fprintf(os.Stderr, "options:\n")
 		flag.PrintDefaults()
 	}
@@ -47,6 +53,12 @@ func main() {
 		err = client.Go(cfg)
 	case modeScript:
 		err = lua.Go(cfg)
+	case modeProxy:
+		err = proxy.Go(cfg)
+	case modeBridge:
+		err = bridge.Go(cfg)
+	case modeAgent:
+		err = agent.Go(cfg)
 	default:
 		err = fmt.Errorf("mode is required to be a one of `%s`; but `%s` given", color.Cyan(strings.Join(modes, "`, `")), color.Yellow(os.Args[1]))
 	}
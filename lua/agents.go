@@ -0,0 +1,252 @@
+package lua
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gobwas/gws/agent/proto"
+	"github.com/gobwas/gws/bufio"
+	"github.com/gobwas/gws/cli"
+	"github.com/gobwas/gws/cli/color"
+	"github.com/gobwas/gws/config"
+	"github.com/gobwas/gws/display"
+	"github.com/gobwas/gws/stat"
+	"github.com/gobwas/gws/stat/results"
+	"github.com/gobwas/gws/ws"
+)
+
+var agents = flag.String("agents", "", "comma separated addresses of agents to run the script on instead of running it locally")
+
+// startDelay is a time given to deliver start message to all agents, which
+// then start the script simultaneously.
+const startDelay = time.Second
+
+// remote is an agent running the job.
+type remote struct {
+	addr string
+	conn *proto.Conn
+
+	mu      sync.Mutex
+	results []results.Result
+}
+
+func (r *remote) setResults(rs []results.Result) {
+	r.mu.Lock()
+	r.results = rs
+	r.mu.Unlock()
+}
+
+func (r *remote) getResults() []results.Result {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.results
+}
+
+// goAgents runs the job on agents, giving each of them a part of the
+// executor load, and renders their merged stats.
+func goAgents(c config.Config, j Job) error {
+	modules, err := readModules(append([]string{filepath.Dir(j.Path)}, j.LuaPath...))
+	if err != nil {
+		return err
+	}
+	addrs := strings.Split(*agents, ",")
+	remotes := make([]*remote, 0, len(addrs))
+	defer func() {
+		for _, r := range remotes {
+			r.conn.Close()
+		}
+	}()
+	for i, addr := range addrs {
+		addr = strings.TrimSpace(addr)
+		uri := addr
+		if !strings.Contains(uri, "://") {
+			uri = "ws://" + uri
+		}
+		conn, resp, err := ws.GetConn(uri, proto.Header(*proto.Token))
+		if err != nil {
+			if resp != nil && resp.StatusCode == http.StatusUnauthorized {
+				err = fmt.Errorf("unauthorized, check -agent-token")
+			}
+			return fmt.Errorf("agent %s: %s", addr, err)
+		}
+		r := &remote{addr: addr, conn: proto.NewConn(conn)}
+		remotes = append(remotes, r)
+
+		err = r.conn.Send(proto.Message{
+			Type:   proto.TypePrepare,
+			Name:   filepath.Base(j.Path),
+			Script: j.Code,
+			Args:   j.Args,
+			URL:    c.URI,
+			Index:  i,
+			Count:  len(addrs),
+
+			Modules:     modules,
+			Coroutine:   j.Settings.Coroutine,
+			OnError:     j.Settings.OnError,
+			Seed:        j.Settings.Seed,
+			VirtualTime: j.Settings.VirtualTime,
+		})
+		if err != nil {
+			return fmt.Errorf("agent %s: %s", addr, err)
+		}
+	}
+	for _, r := range remotes {
+		m, err := r.conn.Receive()
+		if err == nil && m.Type != proto.TypeReady {
+			err = fmt.Errorf("not ready: %s", m.Error)
+		}
+		if err != nil {
+			return fmt.Errorf("agent %s: %s", r.addr, err)
+		}
+	}
+	at := time.Now().Add(startDelay).UnixNano()
+	for _, r := range remotes {
+		if err := r.conn.Send(proto.Message{Type: proto.TypeStart, At: at}); err != nil {
+			return fmt.Errorf("agent %s: %s", r.addr, err)
+		}
+	}
+
+	var outputMu sync.Mutex
+	luaOutputBuffer := bytes.NewBuffer(make([]byte, 0, 1<<13))
+	luaStdout := bufio.NewWriter(luaOutputBuffer, 1<<13)
+
+	systemStdout := bytes.NewBuffer(make([]byte, 0, 1024))
+
+	printer := display.NewDisplay(os.Stderr, display.Config{
+		TabSize:  4,
+		Interval: time.Millisecond * 100,
+	})
+	printer.Row().Col(-1, -1, func() string {
+		lists := make([][]results.Result, len(remotes))
+		for i, r := range remotes {
+			lists[i] = r.getResults()
+		}
+		return stat.Pretty(results.Merge(lists...))
+	})
+	printer.Row().Col(256, 10, func() (str string) {
+		outputMu.Lock()
+		defer outputMu.Unlock()
+		luaStdout.Dump()
+		str = luaOutputBuffer.String()
+		luaOutputBuffer.Reset()
+		return
+	})
+	printer.Row().Col(256, 3, func() (str string) {
+		str = systemStdout.String()
+		return
+	})
+
+	printer.On()
+	defer printer.Off()
+	defer printer.Render()
+
+	var stopOnce sync.Once
+	stop := func() {
+		stopOnce.Do(func() {
+			for _, r := range remotes {
+				r.conn.Send(proto.Message{Type: proto.TypeStop})
+			}
+		})
+	}
+	go func() {
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, os.Interrupt)
+		s := <-c
+		fmt.Fprintln(systemStdout, color.Cyan(cli.PrefixTheEnd), s.String())
+		fmt.Fprintln(systemStdout, color.Cyan("stopping agents softly.."))
+		stop()
+		s = <-c
+		fmt.Fprintln(systemStdout, color.Red(cli.PrefixTheEnd), color.Yellow(s.String()+"x2"))
+		fmt.Fprintln(systemStdout, color.Red("stopping hardly.."))
+		printer.Off()
+		os.Exit(1)
+	}()
+
+	var (
+		wg     sync.WaitGroup
+		errors errorList
+	)
+	for _, r := range remotes {
+		wg.Add(1)
+		go func(r *remote) {
+			defer wg.Done()
+			prefix := color.Magenta(r.addr + " ")
+			for {
+				m, err := r.conn.Receive()
+				if err != nil {
+					errors.add(fmt.Errorf("agent %s: %s", r.addr, err))
+					return
+				}
+				switch m.Type {
+				case proto.TypeReport:
+					r.setResults(m.Results)
+					if m.Output != "" {
+						outputMu.Lock()
+						for _, line := range strings.SplitAfter(m.Output, "\n") {
+							if line != "" {
+								fmt.Fprint(luaStdout, prefix, line)
+							}
+						}
+						outputMu.Unlock()
+					}
+				case proto.TypeDone:
+					if m.Error != "" {
+						errors.add(fmt.Errorf("agent %s: %s", r.addr, m.Error))
+					}
+					return
+				}
+			}
+		}(r)
+	}
+	wg.Wait()
+
+	return errors.err()
+}
+
+// readModules reads lua files from the directories to send them to agents,
+// skipping hidden directories.
+func readModules(dirs []string) ([]map[string]string, error) {
+	modules := make([]map[string]string, len(dirs))
+	for i, dir := range dirs {
+		files := make(map[string]string)
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				if path != dir && strings.HasPrefix(info.Name(), ".") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if filepath.Ext(path) != ".lua" {
+				return nil
+			}
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			files[filepath.ToSlash(rel)] = string(data)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		modules[i] = files
+	}
+	return modules, nil
+}
@@ -4,10 +4,12 @@ import (
 	"bytes"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strings"
 	"sync"
 	"time"
@@ -18,21 +20,80 @@ import (
 	"github.com/gobwas/gws/config"
 	"github.com/gobwas/gws/display"
 	"github.com/gobwas/gws/ev"
+	evHTTP "github.com/gobwas/gws/ev/http"
 	evWS "github.com/gobwas/gws/ev/ws"
+	"github.com/gobwas/gws/lua/mod"
+	modCrypto "github.com/gobwas/gws/lua/mod/crypto"
+	modExecutor "github.com/gobwas/gws/lua/mod/executor"
+	modFS "github.com/gobwas/gws/lua/mod/fs"
+	modHTTP "github.com/gobwas/gws/lua/mod/http"
+	modJSON "github.com/gobwas/gws/lua/mod/json"
+	modRand "github.com/gobwas/gws/lua/mod/rand"
 	modRuntime "github.com/gobwas/gws/lua/mod/runtime"
+	modShared "github.com/gobwas/gws/lua/mod/shared"
 	modStat "github.com/gobwas/gws/lua/mod/stat"
+	modTest "github.com/gobwas/gws/lua/mod/test"
 	modTime "github.com/gobwas/gws/lua/mod/time"
 	modWS "github.com/gobwas/gws/lua/mod/ws"
 	"github.com/gobwas/gws/lua/script"
 	"github.com/gobwas/gws/lua/util"
 	"github.com/gobwas/gws/stat"
+	"github.com/gobwas/gws/stat/counter/abs"
+	"github.com/gobwas/gws/stat/counter/avg"
+	"github.com/yuin/gopher-lua"
 )
 
 var scriptFile = flag.String("path", "", "path to lua script")
 var useDisplay = flag.Bool("display", false, "use display ouput")
+var luaPath = &pathList{}
+var fsRoot = &pathList{}
+var scriptArgs = &argList{}
+var useCoroutine = flag.Bool("coroutine", false, "run script in coroutine, making ws.connect(), conn.send(), conn.receive() and time.sleep() called without callbacks not to block the loop")
+var randSeed = flag.Int64("seed", 0, "seed of rand module generator; forked threads use seed+id+1 (0 means random seed)")
+var junitFile = flag.String("junit", "", "path to write test cases results in JUnit XML format")
+var virtualTime = flag.Bool("virtual-time", false, "use virtual clock which jumps to the next timer when event loop is idle, making timers fire instantly")
+var onError = flag.String("on-error", onErrorAbort, "what to do on error in lua callback: abort the run, stop the thread or continue")
+
+const (
+	onErrorAbort    = "abort"
+	onErrorThread   = "thread"
+	onErrorContinue = "continue"
+)
+
+// errorsStat is a name of built-in stat counting errors in lua callbacks.
+const errorsStat = "gws_errors"
+
+func init() {
+	flag.Var(luaPath, "lua-path", "additional directories to look up lua modules in (could be repeated)")
+	flag.Var(fsRoot, "fs-root", "directories accessible by fs module (could be repeated; script directory by default)")
+	flag.Var(scriptArgs, "arg", "script argument in form of key=value available via runtime.args() (could be repeated)\n\targuments after -- in form of --key=value are also accepted")
+}
+
+type argList []string
+
+func (a *argList) Set(s string) error {
+	*a = append(*a, s)
+	return nil
+}
+
+func (a argList) String() string {
+	return strings.Join(a, ",")
+}
+
+type pathList []string
+
+func (p *pathList) Set(s string) error {
+	*p = append(*p, filepath.SplitList(s)...)
+	return nil
+}
+
+func (p pathList) String() string {
+	return strings.Join(p, string(filepath.ListSeparator))
+}
 
-func initRunTime(loop *ev.Loop, c config.Config) *modRuntime.Runtime {
-	rtime := modRuntime.New(loop)
+func initRunTime(loop *ev.Loop, co *mod.Coroutines, c config.Config, args modRuntime.Args) *modRuntime.Runtime {
+	rtime := modRuntime.New(loop, co)
+	rtime.SetArgs(args)
 	rtime.Set("url", c.URI)
 	rtime.Set("listen", c.Addr)
 	rtime.Set("headers", util.HeadersToMap(c.Headers))
@@ -48,7 +109,61 @@ func initRunTime(loop *ev.Loop, c config.Config) *modRuntime.Runtime {
 	return rtime
 }
 
+// Job is a run of the script. Agents run jobs sent by coordinator.
+type Job struct {
+	// Path is a path to the script; its directory is a default fs root and
+	// the first place to look up required modules in.
+	Path string
+	Code string
+	Args modRuntime.Args
+
+	// Part is a part of the executor module load run by the job.
+	Part modExecutor.Share
+
+	// Stats collects stats of the job if set.
+	Stats *stat.Statistics
+
+	// Output receives output of the script if set. Otherwise stats and
+	// output are rendered on the display.
+	Output io.Writer
+
+	// Stop stops the job softly when closed.
+	Stop <-chan struct{}
+
+	// LuaPath is a list of additional directories to look up modules in.
+	LuaPath []string
+
+	Settings Settings
+}
+
+// Settings are options of the run, which coordinator sends to agents along
+// with the script.
+type Settings struct {
+	Coroutine   bool
+	OnError     string
+	Seed        int64
+	VirtualTime bool
+}
+
+// flagSettings returns settings given by command line flags.
+func flagSettings() Settings {
+	return Settings{
+		Coroutine:   *useCoroutine,
+		OnError:     *onError,
+		Seed:        *randSeed,
+		VirtualTime: *virtualTime,
+	}
+}
+
 func Go(c config.Config) error {
+	settings := flagSettings()
+	if err := settings.check(); err != nil {
+		return err
+	}
+	if *useRepl {
+		return goRepl(c)
+	}
+
 	var code string
 	if script, err := ioutil.ReadFile(*scriptFile); err != nil {
 		return err
@@ -56,89 +171,252 @@ func Go(c config.Config) error {
 		code = string(script)
 	}
 
-	stats := stat.New()
+	args, err := modRuntime.ParseArgs(*scriptArgs, flag.Args())
+	if err != nil {
+		return err
+	}
 
-	luaOutputBuffer := bytes.NewBuffer(make([]byte, 0, 1<<13))
-	luaStdout := bufio.NewWriter(luaOutputBuffer, 1<<13)
+	job := Job{
+		Path:     *scriptFile,
+		Code:     code,
+		Args:     args,
+		LuaPath:  *luaPath,
+		Settings: settings,
+	}
+	if *agents != "" {
+		return goAgents(c, job)
+	}
+	return Run(c, job)
+}
 
-	systemStdout := bytes.NewBuffer(make([]byte, 0, 1024))
+func (s Settings) check() error {
+	switch s.OnError {
+	case onErrorAbort, onErrorThread, onErrorContinue:
+		return nil
+	}
+	return fmt.Errorf("unknown -on-error value: %q", s.OnError)
+}
 
-	printer := display.NewDisplay(os.Stderr, display.Config{
-		TabSize:  4,
-		Interval: time.Millisecond * 100,
-	})
-	printer.Row().Col(-1, -1, func() string {
-		return stats.Pretty()
-	})
-	printer.Row().Col(256, 10, func() (str string) {
-		luaStdout.Dump()
-		str = luaOutputBuffer.String()
-		luaOutputBuffer.Reset()
-		return
-	})
-	printer.Row().Col(256, 3, func() (str string) {
-		str = systemStdout.String()
-		return
-	})
+// Run runs the job and waits for all of its threads to finish.
+func Run(c config.Config, j Job) error {
+	if j.Settings.OnError == "" {
+		j.Settings.OnError = onErrorAbort
+	}
+	if err := j.Settings.check(); err != nil {
+		return err
+	}
+	if j.Part.Count == 0 {
+		j.Part = modExecutor.Share{Index: 0, Count: 1}
+	}
 
-	printer.On()
-	defer printer.Off()
-	defer printer.Render()
+	fs, err := modFS.New(filepath.Dir(j.Path), *fsRoot)
+	if err != nil {
+		return err
+	}
 
-	cancel := make(chan struct{})
-	go func() {
-		c := make(chan os.Signal, 1)
-		signal.Notify(c, os.Interrupt)
-		s := <-c
-		fmt.Fprintln(systemStdout, color.Cyan(cli.PrefixTheEnd), s.String())
-		fmt.Fprintln(systemStdout, color.Cyan("stopping softly.."))
-		close(cancel)
-		s = <-c
-		fmt.Fprintln(systemStdout, color.Red(cli.PrefixTheEnd), color.Yellow(s.String()+"x2"))
-		fmt.Fprintln(systemStdout, color.Red("stopping hardly.."))
-		printer.Off()
-		os.Exit(1)
+	stats := j.Stats
+	if stats == nil {
+		stats = stat.New()
+	}
+	absCounter := func() stat.Counter { return abs.New() }
+	avgCounter := func() stat.Counter { return avg.New() }
+	for name, factory := range map[string]stat.CounterFactory{
+		errorsStat:               absCounter,
+		modExecutor.VUsStat:      absCounter,
+		modExecutor.DroppedStat:  absCounter,
+		modExecutor.DurationStat: avgCounter,
+	} {
+		stats.New(name)
+		stats.Setup(name, stat.Config{Factory: factory})
+	}
+
+	results := modTest.NewResults()
+	defer func() {
+		// Printed after display is turned off.
+		if len(results.Cases()) > 0 {
+			results.WriteSummary(os.Stderr)
+		}
 	}()
 
-	luaScript := script.New()
-	defer luaScript.Shutdown()
+	cancel := make(chan struct{})
+	var cancelOnce sync.Once
+	abort := func() {
+		cancelOnce.Do(func() { close(cancel) })
+	}
+	if j.Stop != nil {
+		go func() {
+			select {
+			case <-j.Stop:
+				abort()
+			case <-cancel:
+			}
+		}()
+	}
+
+	output := j.Output
+	if output == nil {
+		luaOutputBuffer := bytes.NewBuffer(make([]byte, 0, 1<<13))
+		luaStdout := bufio.NewWriter(luaOutputBuffer, 1<<13)
+		output = luaStdout
+
+		systemStdout := bytes.NewBuffer(make([]byte, 0, 1024))
+
+		printer := display.NewDisplay(os.Stderr, display.Config{
+			TabSize:  4,
+			Interval: time.Millisecond * 100,
+		})
+		printer.Row().Col(-1, -1, func() string {
+			return stats.Pretty()
+		})
+		printer.Row().Col(256, 10, func() (str string) {
+			luaStdout.Dump()
+			str = luaOutputBuffer.String()
+			luaOutputBuffer.Reset()
+			return
+		})
+		printer.Row().Col(256, 3, func() (str string) {
+			str = systemStdout.String()
+			return
+		})
+
+		printer.On()
+		defer printer.Off()
+		defer printer.Render()
+
+		go func() {
+			c := make(chan os.Signal, 1)
+			signal.Notify(c, os.Interrupt)
+			s := <-c
+			fmt.Fprintln(systemStdout, color.Cyan(cli.PrefixTheEnd), s.String())
+			fmt.Fprintln(systemStdout, color.Cyan("stopping softly.."))
+			abort()
+			s = <-c
+			fmt.Fprintln(systemStdout, color.Red(cli.PrefixTheEnd), color.Yellow(s.String()+"x2"))
+			fmt.Fprintln(systemStdout, color.Red("stopping hardly.."))
+			printer.Off()
+			os.Exit(1)
+		}()
+	}
 
-	luaScript.HijackOutput(bufio.NewPrefixWriter(luaStdout, color.Green("master > ")))
+	// Modules are looked up relative to the main script directory first.
+	paths := append([]string{filepath.Dir(j.Path)}, j.LuaPath...)
+	newScript := func(prefix string) *script.Script {
+		s := script.New()
+		s.HijackOutput(bufio.NewPrefixWriter(output, color.Green(prefix)))
+		s.SetPath(paths...)
+		return s
+	}
 
-	loop := ev.NewLoop()
+	luaScript := newScript("master > ")
+	defer luaScript.Shutdown()
+
+	loop := j.Settings.newLoop()
 
 	loopServerHandler := evWS.NewServerHandler()
 	loop.Register(evWS.NewClientHandler(), 100)
 	loop.Register(loopServerHandler, 101)
+	loop.Register(evHTTP.NewHandler(), 102)
 
 	sharedStat := modStat.New(stats)
+	sharedStore := modShared.New(modShared.NewStore())
 
 	var wg sync.WaitGroup
 	var threads int
-	rtime := initRunTime(loop, c)
-	rtime.SetForkFn(func() error {
-		go func(id int) {
+	var threadErrors errorList
+
+	// errorHandler returns handler of errors raised by lua callbacks of the
+	// thread. The stop function is called once with "thread" policy.
+	errorHandler := func(thread string, stop func(error)) mod.ErrorHandler {
+		var stopped bool
+		return func(L *lua.LState, err error) {
+			log.Printf("%s: lua callback error: %s", thread, err)
+			stats.Increment(errorsStat, 1, map[string]string{"thread": thread})
+
+			// Traceback is logged above, so keep only the message.
+			if apiErr, ok := err.(*lua.ApiError); ok {
+				err = fmt.Errorf("%s", apiErr.Object)
+			}
+			switch j.Settings.OnError {
+			case onErrorAbort:
+				threadErrors.add(fmt.Errorf("%s: %s", thread, err))
+				abort()
+			case onErrorThread:
+				if !stopped {
+					stopped = true
+					threadErrors.add(fmt.Errorf("%s: %s", thread, err))
+					stop(err)
+				}
+			}
+		}
+	}
+
+	bus := modRuntime.NewBus()
+	co := mod.NewCoroutines(loop)
+	rtime := initRunTime(loop, co, c, j.Args)
+	rtime.SetBus(bus, modRuntime.MasterID)
+	defer bus.Unregister(modRuntime.MasterID)
+	master := rtime
+	fork := func(opts interface{}) (*modRuntime.Thread, error) {
+		id := threads
+		threads++
+		handle := modRuntime.NewThread(id)
+
+		// Thread is registered on the bus before fork returns, so messages
+		// could be sent to it right away; they wait in its loop until the
+		// script is run.
+		loop := j.Settings.newLoop()
+		loop.Register(evWS.NewClientHandler(), 100)
+		loop.Register(loopServerHandler, 101)
+		loop.Register(evHTTP.NewHandler(), 102)
+		handle.SetStop(loop.Stop)
+
+		co := mod.NewCoroutines(loop)
+		rtime := initRunTime(loop, co, c, j.Args)
+		rtime.Set("id", id)
+		rtime.SetBus(bus, id)
+
+		wg.Add(1)
+		go func() {
 			defer wg.Done()
+			defer bus.Unregister(id)
 
-			luaScript := script.New()
+			thread := fmt.Sprintf("thread %.2d", id)
+			luaScript := newScript(thread + " > ")
 			defer luaScript.Shutdown()
-			luaScript.HijackOutput(bufio.NewPrefixWriter(luaStdout, color.Green(fmt.Sprintf("thread %.2d > ", id))))
 
-			loop := ev.NewLoop()
-			loop.Register(evWS.NewClientHandler(), 100)
-			loop.Register(loopServerHandler, 101)
-
-			rtime := initRunTime(loop, c)
-			rtime.Set("id", id)
+			var callbackErr error
+			luaScript.SetErrorHandler(errorHandler(thread, func(err error) {
+				callbackErr = err
+				master.Emit("error", id, err.Error())
+				loop.Stop()
+			}))
+
+			exec := modExecutor.New(loop, co, stats)
+			exec.SetPart(j.Part)
+			if share, ok := opts.(modExecutor.Share); ok {
+				exec.SetShare(share)
+			} else {
+				rtime.SetOpts(opts)
+			}
 
 			luaScript.Preload("runtime", rtime)
 			luaScript.Preload("stat", sharedStat)
-			luaScript.Preload("time", modTime.New(loop))
-			luaScript.Preload("ws", modWS.New(loop))
-
-			err := luaScript.Do(code)
+			luaScript.Preload("shared", sharedStore)
+			luaScript.Preload("time", modTime.New(loop, co))
+			luaScript.Preload("ws", modWS.New(loop, co))
+			luaScript.Preload("json", modJSON.New())
+			luaScript.Preload("http", modHTTP.New(loop))
+			luaScript.Preload("test", modTest.New(loop, results, thread))
+			luaScript.Preload("crypto", modCrypto.New())
+			luaScript.Preload("fs", fs)
+			luaScript.Preload("rand", modRand.New(j.Settings.seed(id)))
+			luaScript.Preload("executor", exec)
+
+			err := j.Settings.run(luaScript, co, j.Path, j.Code)
 			if err != nil {
 				log.Printf("run forked lua script error: %s", err)
+				threadErrors.add(fmt.Errorf("%s: %s", thread, err))
+				master.Emit("error", id, err.Error())
 			}
 
 			loop.Run()
@@ -147,20 +425,36 @@ func Go(c config.Config) error {
 			})
 
 			waitLoop(cancel, loop)
-		}(threads)
-
-		wg.Add(1)
-		threads++
+			if err == nil {
+				err = callbackErr
+			}
+			handle.Finish(err)
+		}()
 
-		return nil
-	})
+		return handle, nil
+	}
+	rtime.SetForkFn(fork)
+	exec := modExecutor.New(loop, co, stats)
+	exec.SetPart(j.Part)
+	exec.SetForkFn(fork)
 
+	luaScript.SetErrorHandler(errorHandler("master", func(error) {
+		loop.Stop()
+	}))
 	luaScript.Preload("runtime", rtime)
 	luaScript.Preload("stat", sharedStat)
-	luaScript.Preload("time", modTime.New(loop))
-	luaScript.Preload("ws", modWS.New(loop))
-
-	err := luaScript.Do(code)
+	luaScript.Preload("shared", sharedStore)
+	luaScript.Preload("time", modTime.New(loop, co))
+	luaScript.Preload("ws", modWS.New(loop, co))
+	luaScript.Preload("json", modJSON.New())
+	luaScript.Preload("http", modHTTP.New(loop))
+	luaScript.Preload("test", modTest.New(loop, results, "master"))
+	luaScript.Preload("crypto", modCrypto.New())
+	luaScript.Preload("fs", fs)
+	luaScript.Preload("rand", modRand.New(j.Settings.seed(modRuntime.MasterID)))
+	luaScript.Preload("executor", exec)
+
+	err = j.Settings.run(luaScript, co, j.Path, j.Code)
 	if err != nil {
 		log.Printf("run lua script error: %s", err)
 		return err
@@ -175,9 +469,80 @@ func Go(c config.Config) error {
 	waitLoop(cancel, loop)
 	wg.Wait()
 
+	if *junitFile != "" {
+		if err := writeJUnit(*junitFile, j.Path, results); err != nil {
+			return err
+		}
+	}
+	if err := threadErrors.err(); err != nil {
+		return err
+	}
+	if failed := results.Failed(); failed > 0 {
+		return fmt.Errorf("%d of %d test cases failed", failed, len(results.Cases()))
+	}
+
 	return nil
 }
 
+func (s Settings) newLoop() *ev.Loop {
+	loop := ev.NewLoop()
+	if s.VirtualTime {
+		loop.SetClock(ev.NewVirtualClock(time.Now()))
+	}
+	return loop
+}
+
+// seed returns seed of rand module for the thread with given id.
+func (s Settings) seed(id int) int64 {
+	if s.Seed == 0 {
+		return time.Now().UnixNano() + int64(id)
+	}
+	return s.Seed + int64(id) + 1
+}
+
+func (s Settings) run(script *script.Script, co *mod.Coroutines, path, code string) error {
+	if s.Coroutine {
+		return script.DoFileCoroutine(co, path, code)
+	}
+	return script.DoFile(path, code)
+}
+
+func writeJUnit(file, path string, results *modTest.Results) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := results.WriteJUnit(f, filepath.Base(path)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// errorList collects errors from multiple threads.
+type errorList struct {
+	mu     sync.Mutex
+	errors []error
+}
+
+func (e *errorList) add(err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.errors = append(e.errors, err)
+}
+
+func (e *errorList) err() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	switch len(e.errors) {
+	case 0:
+		return nil
+	case 1:
+		return e.errors[0]
+	}
+	return fmt.Errorf("%s (and %d more errors)", e.errors[0], len(e.errors)-1)
+}
+
 func waitLoop(cancel chan struct{}, loop *ev.Loop) {
 	select {
 	case <-loop.Done():
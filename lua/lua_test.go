@@ -0,0 +1,360 @@
+package lua
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gobwas/gws/config"
+	"github.com/gobwas/gws/stat"
+	"github.com/gobwas/gws/ws"
+)
+
+// output is a buffer written by multiple threads.
+type output struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (o *output) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.buf.Write(p)
+}
+
+func (o *output) String() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.buf.String()
+}
+
+// runJob runs the job with code written into a temporary script and returns
+// its output and error.
+func runJob(t *testing.T, job Job) (string, error) {
+	dir, err := ioutil.TempDir("", "gws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	out := &output{}
+	job.Path = filepath.Join(dir, "script.lua")
+	job.Output = out
+	done := make(chan error, 1)
+	go func() {
+		done <- Run(config.Config{}, job)
+	}()
+	select {
+	case err = <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("script is not finished; output:\n%s", out)
+	}
+	return out.String(), err
+}
+
+func TestRuntimeSend(t *testing.T) {
+	// Messages are sent right after fork and must be received in order.
+	out, err := runJob(t, Job{Code: `
+		local runtime = require("runtime")
+		if runtime.isMaster() then
+			local t = runtime.fork()
+			for i = 1, 100 do
+				local err = runtime.send(t.id, i)
+				assert(err == nil, err)
+			end
+			local function reply(from, value)
+				print("reply " .. value .. " from " .. from)
+				runtime.off("message", reply)
+			end
+			runtime.on("message", reply)
+		else
+			local last = 0
+			local function receive(from, value)
+				assert(from == runtime.masterId, "message from " .. from)
+				assert(value == last + 1, "got " .. value .. " after " .. last)
+				last = value
+				if last == 100 then
+					runtime.send(from, "done")
+					runtime.off("message", receive)
+				end
+			end
+			runtime.on("message", receive)
+		end
+	`})
+	if err != nil {
+		t.Fatalf("run error: %s; output:\n%s", err, out)
+	}
+	if !strings.Contains(out, "reply done from 0") {
+		t.Errorf("no reply in output:\n%s", out)
+	}
+}
+
+func TestRuntimeBroadcast(t *testing.T) {
+	// Broadcast right after fork reaches every thread, but not the sender.
+	out, err := runJob(t, Job{Code: `
+		local runtime = require("runtime")
+		if runtime.isMaster() then
+			runtime.fork()
+			runtime.fork()
+			runtime.broadcast("hello")
+			local replies = 0
+			local function reply(from, value)
+				print("reply " .. value .. " from " .. from)
+				replies = replies + 1
+				if replies == 2 then
+					runtime.off("message", reply)
+				end
+			end
+			runtime.on("message", reply)
+		else
+			local function receive(from, value)
+				runtime.send(runtime.masterId, value)
+				runtime.off("message", receive)
+			end
+			runtime.on("message", receive)
+		end
+	`})
+	if err != nil {
+		t.Fatalf("run error: %s; output:\n%s", err, out)
+	}
+	for _, want := range []string{"reply hello from 0", "reply hello from 1"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("no %q in output:\n%s", want, out)
+		}
+	}
+}
+
+func TestRuntimeThreads(t *testing.T) {
+	out, err := runJob(t, Job{Code: `
+		local runtime = require("runtime")
+		if runtime.isMaster() then
+			local failed = runtime.fork({ mode = "fail" })
+			failed.join(function(status, err)
+				print("failed: " .. status .. ", " .. tostring(err))
+				-- Join on finished thread calls back with the same status.
+				failed.join(function(status)
+					print("joined again: " .. status)
+				end)
+			end)
+
+			local killed = runtime.fork({ mode = "wait" })
+			local err = runtime.send(killed.id, "hello")
+			assert(err == nil, err)
+			killed.kill()
+			killed.join(function(status, err)
+				print("killed: " .. status .. ", " .. tostring(err))
+			end)
+		elseif runtime.opts.mode == "fail" then
+			error("boom")
+		else
+			-- Thread runs until it is killed.
+			runtime.on("message", function() end)
+		end
+	`})
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("run error is %v; want error of failed thread", err)
+	}
+	for _, want := range []string{
+		"failed: failed, ",
+		"joined again: failed",
+		"killed: killed, nil",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("no %q in output:\n%s", want, out)
+		}
+	}
+}
+
+// errorsCount returns value of the errors counter of the thread.
+func errorsCount(stats *stat.Statistics, thread string) float64 {
+	for _, r := range stats.Results() {
+		if r.Name == errorsStat && r.Tags["thread"] == thread {
+			return r.Value
+		}
+	}
+	return 0
+}
+
+func TestOnError(t *testing.T) {
+	// Thread raises errors in callbacks; its other callbacks and callbacks
+	// of the master print what is still running. Delays are long enough for
+	// the stop to be noticed between callbacks even on a single processor.
+	const code = `
+		local runtime = require("runtime")
+		local time = require("time")
+		if runtime.isMaster() then
+			local function onError(id, err)
+				print("error from " .. id)
+				runtime.off("error", onError)
+			end
+			runtime.on("error", onError)
+			runtime.fork()
+			time.setTimeout(500, function()
+				print("master done")
+			end)
+		else
+			time.setTimeout(10, function()
+				error("boom")
+			end)
+			time.setTimeout(200, function()
+				error("boom")
+			end)
+			time.setTimeout(300, function()
+				print("thread done")
+			end)
+		end
+	`
+	for _, test := range []struct {
+		policy string
+		errors float64
+		err    bool
+		output []string
+		skip   []string
+	}{
+		{
+			policy: onErrorAbort,
+			errors: 1,
+			err:    true,
+			skip:   []string{"thread done", "master done"},
+		},
+		{
+			policy: onErrorThread,
+			errors: 1,
+			err:    true,
+			output: []string{"error from 0", "master done"},
+			skip:   []string{"thread done"},
+		},
+		{
+			policy: onErrorContinue,
+			errors: 2,
+			output: []string{"thread done", "master done"},
+			skip:   []string{"error from 0"},
+		},
+	} {
+		stats := stat.New()
+		out, err := runJob(t, Job{
+			Code:     code,
+			Stats:    stats,
+			Settings: Settings{OnError: test.policy},
+		})
+		if test.err && (err == nil || !strings.Contains(err.Error(), "thread 00: ") || !strings.Contains(err.Error(), "boom")) {
+			t.Errorf("[%s] run error is %v; want error of thread 00", test.policy, err)
+		}
+		if !test.err && err != nil {
+			t.Errorf("[%s] unexpected run error: %s", test.policy, err)
+		}
+		if n := errorsCount(stats, "thread 00"); n != test.errors {
+			t.Errorf("[%s] %s of thread 00 is %v; want %v", test.policy, errorsStat, n, test.errors)
+		}
+		for _, want := range test.output {
+			if !strings.Contains(out, want) {
+				t.Errorf("[%s] no %q in output:\n%s", test.policy, want, out)
+			}
+		}
+		for _, skip := range test.skip {
+			if strings.Contains(out, skip) {
+				t.Errorf("[%s] unexpected %q in output:\n%s", test.policy, skip, out)
+			}
+		}
+	}
+}
+
+// echoServer starts websocket server which sends received messages back.
+func echoServer(t *testing.T) (*httptest.Server, string) {
+	upgrade := ws.GetUpgrader(ws.UpgradeConfig{Origin: "*"})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrade(w, r)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		for {
+			msg, err := ws.ReadFromConn(conn)
+			if err != nil {
+				return
+			}
+			if err := ws.WriteToConn(conn, msg.Kind, msg.Data); err != nil {
+				return
+			}
+		}
+	}))
+	return srv, "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func TestCoroutine(t *testing.T) {
+	srv, url := echoServer(t)
+	defer srv.Close()
+
+	// Timer callback runs before the script continues only if the script
+	// yields while waiting.
+	for _, test := range []struct {
+		name      string
+		coroutine bool
+		code      string
+		output    string
+	}{
+		{
+			name:      "yield",
+			coroutine: true,
+			code: `
+				local ws = require("ws")
+				local time = require("time")
+				time.setTimeout(0, function() print("tick") end)
+				local conn, err = ws.connect({ url = url })
+				assert(err == nil, err)
+				local err = conn.send("hello")
+				assert(err == nil, err)
+				local data, err = conn.receive()
+				assert(err == nil, err)
+				print("received " .. data)
+				time.setTimeout(0, function() print("tick") end)
+				time.sleep("10ms")
+				print("slept")
+				conn.close()
+			`,
+			output: "master > tick\nmaster > received hello\nmaster > tick\nmaster > slept\n",
+		},
+		{
+			name: "fallback",
+			code: `
+				local ws = require("ws")
+				local time = require("time")
+				local ok, err = pcall(ws.connect, { url = url })
+				assert(not ok and string.find(err, "callback expected"), err)
+				ws.connect({ url = url }, function(err, conn)
+					assert(err == nil, err)
+					time.setTimeout(0, function() print("tick") end)
+					local err = conn.send("hello")
+					assert(err == nil, err)
+					local data, err = conn.receive()
+					assert(err == nil, err)
+					print("received " .. data)
+					time.sleep("10ms")
+					print("slept")
+					conn.close()
+				end)
+			`,
+			output: "master > received hello\nmaster > slept\nmaster > tick\n",
+		},
+	} {
+		out, err := runJob(t, Job{
+			Code:     "local url = " + strconv.Quote(url) + "\n" + test.code,
+			Settings: Settings{Coroutine: test.coroutine},
+		})
+		if err != nil {
+			t.Errorf("[%s] run error: %s", test.name, err)
+		}
+		if out != test.output {
+			t.Errorf("[%s] output is %q; want %q", test.name, out, test.output)
+		}
+	}
+}
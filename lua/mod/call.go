@@ -0,0 +1,45 @@
+package mod
+
+import (
+	"log"
+
+	"github.com/yuin/gopher-lua"
+)
+
+const errorHandlerKey = "gws.errorHandler"
+
+// ErrorHandler is called with error raised by lua callback.
+type ErrorHandler func(L *lua.LState, err error)
+
+// SetErrorHandler sets handler of errors raised by callbacks called via Call.
+// Handler is shared between L and its coroutines.
+func SetErrorHandler(L *lua.LState, h ErrorHandler) {
+	ud := L.NewUserData()
+	ud.Value = h
+	L.SetField(L.Get(lua.RegistryIndex), errorHandlerKey, ud)
+}
+
+// Call calls lua callback in protected mode. Error raised by callback is
+// passed to the error handler set by SetErrorHandler. Error message contains
+// script position and stack traceback.
+func Call(L *lua.LState, fn *lua.LFunction, args ...lua.LValue) {
+	err := L.CallByParam(lua.P{
+		Fn:      fn,
+		NRet:    0,
+		Protect: true,
+	}, args...)
+	if err != nil {
+		HandleError(L, err)
+	}
+}
+
+// HandleError passes err to the error handler of L. If there is no handler,
+// error is logged.
+func HandleError(L *lua.LState, err error) {
+	ud, ok := L.GetField(L.Get(lua.RegistryIndex), errorHandlerKey).(*lua.LUserData)
+	if !ok {
+		log.Printf("lua error: %s", err)
+		return
+	}
+	ud.Value.(ErrorHandler)(L, err)
+}
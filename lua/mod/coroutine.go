@@ -0,0 +1,94 @@
+package mod
+
+import (
+	"github.com/gobwas/gws/ev"
+	"github.com/yuin/gopher-lua"
+)
+
+// Coroutines runs lua functions in coroutines which are resumed by event loop
+// callbacks. This makes it possible for blocking module functions to yield
+// instead of blocking the whole loop.
+type Coroutines struct {
+	loop    *ev.Loop
+	threads map[*lua.LState]*lua.LState // thread to its resumer
+	done    map[*lua.LState]func([]lua.LValue, error)
+}
+
+func NewCoroutines(loop *ev.Loop) *Coroutines {
+	return &Coroutines{
+		loop:    loop,
+		threads: make(map[*lua.LState]*lua.LState),
+		done:    make(map[*lua.LState]func([]lua.LValue, error)),
+	}
+}
+
+// Spawn calls fn with args in a new coroutine. It runs fn until the first
+// yield and returns error if it happened before.
+func (c *Coroutines) Spawn(L *lua.LState, fn *lua.LFunction, args ...lua.LValue) error {
+	// Resume coroutines always from the main thread, because the spawning
+	// one could be suspended or dead at time of the next resume.
+	for L.Parent != nil {
+		L = L.Parent
+	}
+	th, _ := L.NewThread()
+	c.threads[th] = L
+
+	return c.resume(th, fn, args...)
+}
+
+// Go is like Spawn, but calls done with values returned by fn or error raised
+// by it when coroutine finishes. Errors are not passed to the error handler.
+func (c *Coroutines) Go(L *lua.LState, fn *lua.LFunction, done func([]lua.LValue, error), args ...lua.LValue) {
+	for L.Parent != nil {
+		L = L.Parent
+	}
+	th, _ := L.NewThread()
+	c.threads[th] = L
+	c.done[th] = done
+
+	c.resume(th, fn, args...)
+}
+
+// CanYield reports whether L is a running coroutine created by Spawn.
+func (c *Coroutines) CanYield(L *lua.LState) bool {
+	_, ok := c.threads[L]
+	return ok && L.G.CurrentThread == L
+}
+
+// Yield suspends L until resume passed to start is called. Values passed to
+// resume are returned to the lua code. It must be used as the return
+// statement of lua function:
+//
+//	return co.Yield(L, func(resume func(...lua.LValue)) { ... })
+//
+// Resume could be called only once from the loop goroutine.
+func (c *Coroutines) Yield(L *lua.LState, start func(resume func(...lua.LValue))) int {
+	start(func(values ...lua.LValue) {
+		// Resume with no values leaves registers of assignment like
+		// "local err = f()" unset instead of nil.
+		if len(values) == 0 {
+			values = []lua.LValue{lua.LNil}
+		}
+		// Always resume in the next loop tick to be sure that L has yielded.
+		c.loop.Call(func() {
+			if err := c.resume(L, nil, values...); err != nil {
+				HandleError(L, err)
+			}
+		})
+	})
+	return L.Yield()
+}
+
+func (c *Coroutines) resume(th *lua.LState, fn *lua.LFunction, args ...lua.LValue) error {
+	st, err, values := c.threads[th].Resume(th, fn, args...)
+	if st == lua.ResumeYield {
+		return nil
+	}
+	delete(c.threads, th)
+	if done, ok := c.done[th]; ok {
+		delete(c.done, th)
+		done(values, err)
+		return nil
+	}
+	return err
+}
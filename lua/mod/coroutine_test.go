@@ -0,0 +1,64 @@
+package mod
+
+import (
+	"testing"
+
+	"github.com/gobwas/gws/ev"
+	"github.com/yuin/gopher-lua"
+)
+
+func TestCoroutines(t *testing.T) {
+	loop := ev.NewLoop()
+	co := NewCoroutines(loop)
+
+	L := lua.NewState()
+	defer L.Close()
+	// wait(...) yields inside of coroutine and returns its arguments on the
+	// next loop tick. Outside of coroutine it returns false.
+	L.SetGlobal("wait", L.NewFunction(func(L *lua.LState) int {
+		if !co.CanYield(L) {
+			L.Push(lua.LFalse)
+			return 1
+		}
+		var args []lua.LValue
+		for i := 1; i <= L.GetTop(); i++ {
+			args = append(args, L.Get(i))
+		}
+		return co.Yield(L, func(resume func(...lua.LValue)) {
+			loop.Call(func() { resume(args...) })
+		})
+	}))
+	var results []string
+	L.SetGlobal("result", L.NewFunction(func(L *lua.LState) int {
+		results = append(results, L.ToString(1))
+		return 0
+	}))
+
+	if err := L.DoString(`result(tostring(wait(1)))`); err != nil {
+		t.Fatal(err)
+	}
+	fn, err := L.LoadString(`
+		local a, b = wait(1, 2)
+		result(a + b)
+		local v = wait()
+		result(tostring(v))
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := co.Spawn(L, fn); err != nil {
+		t.Fatal(err)
+	}
+	loop.Run()
+	<-loop.Done()
+
+	want := []string{"false", "3", "nil"}
+	if len(results) != len(want) {
+		t.Fatalf("got results %q; want %q", results, want)
+	}
+	for i := range want {
+		if results[i] != want[i] {
+			t.Errorf("result #%d is %q; want %q", i, results[i], want[i])
+		}
+	}
+}
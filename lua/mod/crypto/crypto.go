@@ -0,0 +1,116 @@
+// Package crypto brings lua module with hash functions and encodings.
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+
+	"github.com/yuin/gopher-lua"
+)
+
+var hashes = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// Mod is a "crypto" lua module. Hash functions return raw bytes which could
+// be encoded by hex or base64 functions.
+type Mod struct{}
+
+func New() *Mod {
+	return &Mod{}
+}
+
+func (m *Mod) Exports() lua.LGFunction {
+	return func(L *lua.LState) int {
+		mod := L.NewTable()
+
+		for name, h := range hashes {
+			h := h
+			mod.RawSetString(name, L.NewClosure(func(L *lua.LState) int {
+				d := h()
+				d.Write([]byte(L.CheckString(1)))
+				L.Push(lua.LString(d.Sum(nil)))
+				return 1
+			}))
+		}
+
+		// hmac(alg, key, data) returns signature and error.
+		mod.RawSetString("hmac", L.NewClosure(func(L *lua.LState) int {
+			alg := L.CheckString(1)
+			h, ok := hashes[alg]
+			if !ok {
+				L.Push(lua.LNil)
+				L.Push(lua.LString(fmt.Sprintf("unknown hash algorithm %q", alg)))
+				return 2
+			}
+			mac := hmac.New(h, []byte(L.CheckString(2)))
+			mac.Write([]byte(L.CheckString(3)))
+			L.Push(lua.LString(mac.Sum(nil)))
+			return 1
+		}))
+
+		// base64Encode(data[, opts]) and base64Decode(str[, opts]).
+		// opts is a table with optional "url" and "raw" (no padding) fields.
+		mod.RawSetString("base64Encode", L.NewClosure(func(L *lua.LState) int {
+			enc := base64Encoding(L.ToTable(2))
+			L.Push(lua.LString(enc.EncodeToString([]byte(L.CheckString(1)))))
+			return 1
+		}))
+		mod.RawSetString("base64Decode", L.NewClosure(func(L *lua.LState) int {
+			enc := base64Encoding(L.ToTable(2))
+			return pushDecoded(L, func(s string) ([]byte, error) {
+				return enc.DecodeString(s)
+			})
+		}))
+
+		mod.RawSetString("hexEncode", L.NewClosure(func(L *lua.LState) int {
+			L.Push(lua.LString(hex.EncodeToString([]byte(L.CheckString(1)))))
+			return 1
+		}))
+		mod.RawSetString("hexDecode", L.NewClosure(func(L *lua.LState) int {
+			return pushDecoded(L, hex.DecodeString)
+		}))
+
+		L.Push(mod)
+		return 1
+	}
+}
+
+func base64Encoding(opts *lua.LTable) *base64.Encoding {
+	var url, raw bool
+	if opts != nil {
+		url = lua.LVAsBool(opts.RawGetString("url"))
+		raw = lua.LVAsBool(opts.RawGetString("raw"))
+	}
+	switch {
+	case url && raw:
+		return base64.RawURLEncoding
+	case url:
+		return base64.URLEncoding
+	case raw:
+		return base64.RawStdEncoding
+	default:
+		return base64.StdEncoding
+	}
+}
+
+func pushDecoded(L *lua.LState, decode func(string) ([]byte, error)) int {
+	data, err := decode(L.CheckString(1))
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	L.Push(lua.LString(data))
+	return 1
+}
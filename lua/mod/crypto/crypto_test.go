@@ -0,0 +1,38 @@
+package crypto
+
+import (
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestCrypto(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+	L.PreloadModule("crypto", New().Exports())
+
+	err := L.DoString(`
+		local crypto = require("crypto")
+
+		assert(crypto.hexEncode(crypto.md5("abc")) == "900150983cd24fb0d6963f7d28e17f72")
+		assert(crypto.hexEncode(crypto.sha1("abc")) == "a9993e364706816aba3e25717850c26c9cd0d89d")
+		assert(crypto.hexEncode(crypto.sha256("abc")) == "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad")
+		assert(crypto.hexEncode(crypto.hmac("sha256", "key", "The quick brown fox jumps over the lazy dog")) ==
+			"f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8")
+		local _, err = crypto.hmac("md4", "key", "data")
+		assert(err ~= nil)
+
+		assert(crypto.base64Encode("\251\255") == "+/8=")
+		assert(crypto.base64Encode("\251\255", { url = true, raw = true }) == "-_8")
+		assert(crypto.base64Decode("-_8", { url = true, raw = true }) == "\251\255")
+		local v, err = crypto.base64Decode("!!!")
+		assert(v == nil and err ~= nil)
+
+		assert(crypto.hexDecode("6869") == "hi")
+		local v, err = crypto.hexDecode("zz")
+		assert(v == nil and err ~= nil)
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
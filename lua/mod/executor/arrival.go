@@ -0,0 +1,220 @@
+package executor
+
+import (
+	"fmt"
+	"time"
+
+	luamod "github.com/gobwas/gws/lua/mod"
+	"github.com/yuin/gopher-lua"
+)
+
+// DroppedStat is a name of built-in stat with number of iterations which were
+// not started because there was no free virtual user.
+const DroppedStat = "gws_dropped_iterations"
+
+// DurationStat is a name of built-in stat with duration of iterations in
+// milliseconds. It is measured from the scheduled start of iteration, so
+// delays of the start caused by slow previous iterations are not hidden.
+const DurationStat = "gws_iteration_duration"
+
+type arrivalVU struct {
+	table     *lua.LTable
+	iteration int
+	scheduled time.Time
+	resume    func(...lua.LValue)
+}
+
+// arrival starts iterations at the rate given by profile (in iterations per
+// second) regardless of how long they take. Thread runs every Count-th
+// iteration of the whole schedule starting from the Index-th.
+type arrival struct {
+	mod     *Mod
+	profile Profile
+	share   Share
+	maxVUs  int
+	done    *lua.LFunction
+
+	loop    *lua.LFunction
+	fn      *lua.LFunction
+	begin   time.Time
+	next    int
+	idle    []*arrivalVU
+	vus     int
+	created int
+	ending  bool
+}
+
+func (r *arrival) start(L *lua.LState, fn *lua.LFunction, preAllocated int) {
+	loop, err := L.LoadString(vuLoop)
+	if err != nil {
+		panic(err)
+	}
+	r.loop = loop
+	r.fn = fn
+	r.begin = r.mod.loop.Now()
+	r.next = r.share.Index
+	for i := 0; i < preAllocated && r.vus < r.maxVUs; i++ {
+		r.allocate(L)
+	}
+	r.schedule(L)
+}
+
+// schedule starts iterations which time has come and sets timer for the next
+// one.
+func (r *arrival) schedule(L *lua.LState) {
+	elapsed := r.mod.loop.Now().Sub(r.begin)
+	for {
+		at, ok := r.profile.Until(float64(r.next))
+		if !ok || at >= r.profile.Duration() {
+			r.end(L)
+			return
+		}
+		if at > elapsed {
+			r.mod.loop.Timeout(at-elapsed, false, func() {
+				r.schedule(L)
+			})
+			return
+		}
+		r.iterate(L, r.begin.Add(at))
+		r.next += r.share.Count
+	}
+}
+
+// iterate gives iteration to an idle virtual user, allocating a new one if
+// needed. Iteration is dropped if maximum number of users is busy.
+func (r *arrival) iterate(L *lua.LState, scheduled time.Time) {
+	if len(r.idle) == 0 && r.vus < r.maxVUs {
+		r.allocate(L)
+	}
+	n := len(r.idle)
+	if n == 0 {
+		r.mod.stats.Increment(DroppedStat, 1, nil)
+		return
+	}
+	v := r.idle[n-1]
+	r.idle = r.idle[:n-1]
+
+	v.iteration++
+	v.scheduled = scheduled
+	v.table.RawSetString("iteration", lua.LNumber(v.iteration))
+	resume := v.resume
+	v.resume = nil
+	resume(lua.LTrue)
+}
+
+// allocate starts a new virtual user, which becomes idle immediately.
+func (r *arrival) allocate(L *lua.LState) {
+	v := &arrivalVU{table: L.NewTable()}
+	v.table.RawSetString("id", lua.LNumber(r.share.ID(r.created)))
+	// elapsed() returns milliseconds since the scheduled start of the
+	// current iteration.
+	v.table.RawSetString("elapsed", L.NewFunction(func(L *lua.LState) int {
+		L.Push(lua.LNumber(milliseconds(r.mod.loop.Now().Sub(v.scheduled))))
+		return 1
+	}))
+	r.created++
+	r.vus++
+	r.mod.addVUs(1)
+
+	next := L.NewFunction(func(L *lua.LState) int {
+		if !v.scheduled.IsZero() {
+			d := r.mod.loop.Now().Sub(v.scheduled)
+			r.mod.stats.Increment(DurationStat, milliseconds(d), nil)
+			v.scheduled = time.Time{}
+		}
+		return r.mod.co.Yield(L, func(resume func(...lua.LValue)) {
+			if r.ending {
+				resume(lua.LFalse)
+				return
+			}
+			v.resume = resume
+			r.idle = append(r.idle, v)
+		})
+	})
+	r.mod.co.Go(L, r.loop, func(_ []lua.LValue, err error) {
+		r.vus--
+		r.mod.addVUs(-1)
+		if err != nil {
+			luamod.HandleError(L, err)
+		}
+		if r.ending && r.vus == 0 {
+			r.finish(L)
+		}
+	}, r.fn, v.table, next)
+}
+
+// end stops idle virtual users; busy ones stop after current iteration.
+func (r *arrival) end(L *lua.LState) {
+	r.ending = true
+	for _, v := range r.idle {
+		v.resume(lua.LFalse)
+	}
+	r.idle = nil
+	if r.vus == 0 {
+		r.finish(L)
+	}
+}
+
+func (r *arrival) finish(L *lua.LState) {
+	if r.done != nil {
+		luamod.Call(L, r.done)
+		r.done = nil
+	}
+}
+
+// arrivalFromTable reads options of arrival rate executors. Rates are given
+// per "timeUnit" (one second by default).
+func arrivalFromTable(opts *lua.LTable, constant bool) (p Profile, preAllocated, maxVUs int, err error) {
+	if constant {
+		rate, ok := opts.RawGetString("rate").(lua.LNumber)
+		if !ok || rate <= 0 {
+			return p, 0, 0, fmt.Errorf("rate is expected to be a positive number")
+		}
+		d, err := durationFromValue(opts.RawGetString("duration"))
+		if err != nil {
+			return p, 0, 0, err
+		}
+		p = Profile{
+			Start:  float64(rate),
+			Stages: []Stage{{Duration: d, Target: float64(rate)}},
+		}
+	} else {
+		if p, err = profileFromTable(opts, "startRate"); err != nil {
+			return p, 0, 0, err
+		}
+	}
+
+	unit := time.Second
+	if v := opts.RawGetString("timeUnit"); v != lua.LNil {
+		if unit, err = durationFromValue(v); err != nil {
+			return p, 0, 0, err
+		}
+		if unit <= 0 {
+			return p, 0, 0, fmt.Errorf("timeUnit is expected to be positive")
+		}
+	}
+	perSecond := func(rate float64) float64 {
+		return rate / unit.Seconds()
+	}
+	p.Start = perSecond(p.Start)
+	for i := range p.Stages {
+		p.Stages[i].Target = perSecond(p.Stages[i].Target)
+	}
+
+	preAllocated = 1
+	if n, ok := opts.RawGetString("preAllocatedVUs").(lua.LNumber); ok {
+		preAllocated = int(n)
+	}
+	maxVUs = preAllocated
+	if n, ok := opts.RawGetString("maxVUs").(lua.LNumber); ok {
+		maxVUs = int(n)
+	}
+	if preAllocated < 0 || maxVUs < 1 || maxVUs < preAllocated {
+		return p, 0, 0, fmt.Errorf("maxVUs is expected to be positive and not less than preAllocatedVUs")
+	}
+	return p, preAllocated, maxVUs, nil
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
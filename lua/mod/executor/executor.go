@@ -0,0 +1,365 @@
+// Package executor brings lua module which schedules virtual users over
+// stages of load profile.
+package executor
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+
+	"github.com/gobwas/gws/ev"
+	luamod "github.com/gobwas/gws/lua/mod"
+	modRuntime "github.com/gobwas/gws/lua/mod/runtime"
+	"github.com/gobwas/gws/stat"
+	"github.com/yuin/gopher-lua"
+)
+
+// VUsStat is a name of built-in stat with number of active virtual users.
+const VUsStat = "gws_vus"
+
+// tickInterval is how often number of virtual users is adjusted.
+const tickInterval = 100 * time.Millisecond
+
+// vuLoop calls iteration function while next() returns true. It is written
+// in lua, because coroutine could not yield across go function calling fn.
+const vuLoop = `
+local fn, vu, next = ...
+while next() do
+	fn(vu)
+end
+`
+
+type forkFn func(opts interface{}) (*modRuntime.Thread, error)
+
+// Mod is an "executor" lua module.
+//
+// Executor called in the master thread forks threads and gives each of them
+// a share of the load. Forked threads run the same script, so executor must
+// be called with the same options in every thread. Executor called in a
+// thread forked manually runs the whole load by itself.
+type Mod struct {
+	loop  *ev.Loop
+	co    *luamod.Coroutines
+	stats *stat.Statistics
+	fork  forkFn
+	share *Share
+	part  Share
+}
+
+func New(loop *ev.Loop, co *luamod.Coroutines, stats *stat.Statistics) *Mod {
+	return &Mod{
+		loop:  loop,
+		co:    co,
+		stats: stats,
+		part:  Share{Index: 0, Count: 1},
+	}
+}
+
+// SetForkFn makes executor to fork threads to run the load.
+func (m *Mod) SetForkFn(f forkFn) {
+	m.fork = f
+}
+
+// SetPart sets part of the whole load given to this process, which is split
+// between its threads.
+func (m *Mod) SetPart(p Share) {
+	m.part = p
+}
+
+// SetShare sets share of the load run by this thread.
+func (m *Mod) SetShare(s Share) {
+	m.share = &s
+}
+
+func (m *Mod) Exports() lua.LGFunction {
+	return func(L *lua.LState) int {
+		mod := L.NewTable()
+
+		// ramping(opts, fn[, done]) runs virtual users, which call fn(vu)
+		// in a loop, changing their number over stages:
+		//
+		//	executor.ramping({
+		//		startVUs = 0,
+		//		stages = {
+		//			{ duration = "2m", target = 1000 },
+		//			{ duration = "10m", target = 1000 },
+		//			{ duration = "1m", target = 0 },
+		//		},
+		//	}, function(vu) ... end)
+		//
+		// The vu table has "id" and "iteration" fields and keeps other fields
+		// between iterations. Iterations run in coroutines. Stopped virtual
+		// users finish their current iteration. Optional "threads" number is
+		// a number of threads to fork (runtime.numCPU by default; 0 runs all
+		// virtual users in the current thread). Callback done is called when
+		// all virtual users stop. Returns error.
+		mod.RawSetString("ramping", L.NewClosure(func(L *lua.LState) int {
+			opts := L.CheckTable(1)
+			fn := L.CheckFunction(2)
+			done := L.OptFunction(3, nil)
+
+			profile, err := profileFromTable(opts, "startVUs")
+			if err == nil {
+				err = m.start(L, opts, done, 0, func(share Share) {
+					r := &ramping{
+						mod:     m,
+						profile: profile,
+						share:   share,
+						done:    done,
+					}
+					r.start(L, fn)
+				})
+			}
+			if err != nil {
+				L.Push(lua.LString(err.Error()))
+				return 1
+			}
+			return 0
+		}))
+
+		// constantArrivalRate(opts, fn[, done]) starts iterations of fn(vu) at
+		// fixed rate regardless of how long they take:
+		//
+		//	executor.constantArrivalRate({
+		//		rate = 100,
+		//		timeUnit = "1s",
+		//		duration = "1m",
+		//		preAllocatedVUs = 10,
+		//		maxVUs = 50,
+		//	}, function(vu) ... end)
+		//
+		// Iterations are given to idle virtual users; new ones are allocated
+		// up to maxVUs, and iterations are dropped when all of them are busy.
+		// The vu table has also "elapsed" function returning milliseconds
+		// since the scheduled start of the current iteration, which is useful
+		// to account latency for delayed starts. No more than maxVUs threads
+		// are forked. Other options, done callback and returned value are the
+		// same as for ramping.
+		mod.RawSetString("constantArrivalRate", L.NewClosure(m.arrival(true)))
+
+		// rampingArrivalRate(opts, fn[, done]) is like constantArrivalRate,
+		// but changes the rate from "startRate" over "stages", which targets
+		// are rates per timeUnit.
+		mod.RawSetString("rampingArrivalRate", L.NewClosure(m.arrival(false)))
+
+		L.Push(mod)
+		return 1
+	}
+}
+
+func (m *Mod) arrival(constant bool) lua.LGFunction {
+	return func(L *lua.LState) int {
+		opts := L.CheckTable(1)
+		fn := L.CheckFunction(2)
+		done := L.OptFunction(3, nil)
+
+		profile, preAllocated, maxVUs, err := arrivalFromTable(opts, constant)
+		if err == nil {
+			// Threads without virtual users would drop all of their
+			// iterations, so there are no more threads than users, and every
+			// share has at least one user.
+			err = m.start(L, opts, done, atLeastOne(m.part.Of(maxVUs)), func(share Share) {
+				r := &arrival{
+					mod:     m,
+					profile: profile,
+					share:   share,
+					maxVUs:  atLeastOne(share.Of(maxVUs)),
+					done:    done,
+				}
+				r.start(L, fn, share.Of(preAllocated))
+			})
+		}
+		if err != nil {
+			L.Push(lua.LString(err.Error()))
+			return 1
+		}
+		return 0
+	}
+}
+
+// start forks threads or calls run with share of the current thread. Number
+// of threads is limited by maxThreads if it is positive.
+func (m *Mod) start(L *lua.LState, opts *lua.LTable, done *lua.LFunction, maxThreads int, run func(Share)) error {
+	if m.share != nil {
+		run(*m.share)
+		return nil
+	}
+	threads := runtime.NumCPU()
+	if n, ok := opts.RawGetString("threads").(lua.LNumber); ok {
+		threads = int(n)
+	}
+	if maxThreads > 0 && threads > maxThreads {
+		threads = maxThreads
+	}
+	if m.fork == nil || threads <= 0 {
+		run(m.part)
+		return nil
+	}
+
+	handles := make([]*modRuntime.Thread, threads)
+	for i := range handles {
+		h, err := m.fork(m.part.Part(Share{Index: i, Count: threads}))
+		if err != nil {
+			return err
+		}
+		handles[i] = h
+	}
+	if done != nil {
+		m.loop.Ref()
+		go func() {
+			for _, h := range handles {
+				<-h.Done()
+			}
+			m.loop.Call(func() {
+				m.loop.Unref()
+				luamod.Call(L, done)
+			})
+		}()
+	}
+	return nil
+}
+
+func atLeastOne(n int) int {
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+func (m *Mod) addVUs(n int) {
+	m.stats.Increment(VUsStat, float64(n), nil)
+}
+
+type vu struct {
+	table   *lua.LTable
+	active  bool
+	running bool
+}
+
+type ramping struct {
+	mod     *Mod
+	profile Profile
+	share   Share
+	done    *lua.LFunction
+
+	loop    *lua.LFunction
+	fn      *lua.LFunction
+	begin   time.Time
+	timer   *ev.Timer
+	vus     []*vu
+	running int
+	ending  bool
+}
+
+func (r *ramping) start(L *lua.LState, fn *lua.LFunction) {
+	loop, err := L.LoadString(vuLoop)
+	if err != nil {
+		panic(err)
+	}
+	r.loop = loop
+	r.fn = fn
+	r.begin = r.mod.loop.Now()
+	r.timer = r.mod.loop.Timeout(tickInterval, true, func() {
+		r.tick(L)
+	})
+	r.tick(L)
+}
+
+func (r *ramping) tick(L *lua.LState) {
+	elapsed := r.mod.loop.Now().Sub(r.begin)
+	target := r.share.Of(int(r.profile.At(elapsed)))
+	if elapsed >= r.profile.Duration() {
+		target = 0
+		r.ending = true
+		r.timer.Stop()
+	}
+	for k := len(r.vus); k < target; k++ {
+		table := L.NewTable()
+		table.RawSetString("id", lua.LNumber(r.share.ID(k)))
+		r.vus = append(r.vus, &vu{table: table})
+	}
+	for k, v := range r.vus {
+		v.active = k < target
+		if v.active && !v.running {
+			r.run(L, v)
+		}
+	}
+	if r.ending && r.running == 0 {
+		r.finish(L)
+	}
+}
+
+func (r *ramping) run(L *lua.LState, v *vu) {
+	v.running = true
+	r.running++
+	r.mod.addVUs(1)
+
+	var iteration int
+	next := L.NewFunction(func(L *lua.LState) int {
+		return r.mod.co.Yield(L, func(resume func(...lua.LValue)) {
+			if v.active {
+				iteration++
+				v.table.RawSetString("iteration", lua.LNumber(iteration))
+			}
+			resume(lua.LBool(v.active))
+		})
+	})
+	r.mod.co.Go(L, r.loop, func(_ []lua.LValue, err error) {
+		v.running = false
+		r.running--
+		r.mod.addVUs(-1)
+		if err != nil {
+			luamod.HandleError(L, err)
+		}
+		if r.ending && r.running == 0 {
+			r.finish(L)
+		}
+	}, r.fn, v.table, next)
+}
+
+func (r *ramping) finish(L *lua.LState) {
+	if r.done != nil {
+		luamod.Call(L, r.done)
+		r.done = nil
+	}
+}
+
+// profileFromTable reads "stages" array and start value from the field with
+// given name.
+func profileFromTable(opts *lua.LTable, startField string) (p Profile, err error) {
+	if n, ok := opts.RawGetString(startField).(lua.LNumber); ok {
+		p.Start = float64(n)
+	}
+	stages, ok := opts.RawGetString("stages").(*lua.LTable)
+	if !ok || stages.Len() == 0 {
+		return p, fmt.Errorf("stages are expected to be a non-empty array")
+	}
+	for i := 1; i <= stages.Len(); i++ {
+		s, ok := stages.RawGetInt(i).(*lua.LTable)
+		if !ok {
+			return p, fmt.Errorf("stage #%d is expected to be a table", i)
+		}
+		d, err := durationFromValue(s.RawGetString("duration"))
+		if err != nil {
+			return p, fmt.Errorf("stage #%d: %s", i, err)
+		}
+		target, ok := s.RawGetString("target").(lua.LNumber)
+		if !ok || target < 0 {
+			return p, fmt.Errorf("stage #%d: target is expected to be a non-negative number", i)
+		}
+		p.Stages = append(p.Stages, Stage{Duration: d, Target: float64(target)})
+	}
+	return p, nil
+}
+
+// durationFromValue parses duration string like "1m30s" or number of
+// milliseconds.
+func durationFromValue(v lua.LValue) (time.Duration, error) {
+	switch x := v.(type) {
+	case lua.LString:
+		return time.ParseDuration(string(x))
+	case lua.LNumber:
+		return time.Duration(float64(x) * float64(time.Millisecond)), nil
+	}
+	return 0, fmt.Errorf("duration is expected to be a string or number of milliseconds")
+}
@@ -0,0 +1,104 @@
+package executor
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gobwas/gws/ev"
+	luamod "github.com/gobwas/gws/lua/mod"
+	modRuntime "github.com/gobwas/gws/lua/mod/runtime"
+	"github.com/gobwas/gws/stat"
+	"github.com/gobwas/gws/stat/counter/abs"
+	"github.com/gobwas/gws/stat/counter/avg"
+	"github.com/yuin/gopher-lua"
+)
+
+func TestArrivalThreads(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		opts    string
+		threads int
+	}{
+		{"default VUs", `preAllocatedVUs = 1`, 1},
+		{"less VUs than threads", `preAllocatedVUs = 1, maxVUs = 2`, 2},
+		{"more VUs than threads", `preAllocatedVUs = 8`, 4},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			script := `
+				local executor = require("executor")
+				local err = executor.constantArrivalRate({
+					rate = 100, duration = "2s", threads = 4, ` + test.opts + `
+				}, function(vu) end, function() done = true end)
+				assert(err == nil, err)
+			`
+			stats := stat.New()
+			for name, factory := range map[string]stat.CounterFactory{
+				VUsStat:      func() stat.Counter { return abs.New() },
+				DroppedStat:  func() stat.Counter { return abs.New() },
+				DurationStat: func() stat.Counter { return avg.New() },
+			} {
+				stats.New(name)
+				stats.Setup(name, stat.Config{Factory: factory})
+			}
+
+			var (
+				mu      sync.Mutex
+				threads int
+			)
+			fork := func(opts interface{}) (*modRuntime.Thread, error) {
+				mu.Lock()
+				threads++
+				mu.Unlock()
+				h := modRuntime.NewThread(0)
+				go func() {
+					runScript(t, stats, script, func(m *Mod) {
+						m.SetShare(opts.(Share))
+					}).Close()
+					h.Finish(nil)
+				}()
+				return h, nil
+			}
+			L := runScript(t, stats, script, func(m *Mod) {
+				m.SetForkFn(fork)
+			})
+			defer L.Close()
+			if L.GetGlobal("done") != lua.LTrue {
+				t.Errorf("done callback was not called")
+			}
+			if threads != test.threads {
+				t.Errorf("forked %d threads; want %d", threads, test.threads)
+			}
+
+			var iterations, dropped float64
+			for _, r := range stats.Results() {
+				switch r.Name {
+				case DurationStat:
+					iterations += r.Count
+				case DroppedStat:
+					dropped += r.Value
+				}
+			}
+			if iterations != 200 || dropped != 0 {
+				t.Errorf("got %v iterations and %v dropped; want 200 and 0", iterations, dropped)
+			}
+		})
+	}
+}
+
+// runScript runs script with executor module until its loop is done.
+func runScript(t *testing.T, stats *stat.Statistics, script string, setup func(*Mod)) *lua.LState {
+	loop := ev.NewLoop()
+	loop.SetClock(ev.NewVirtualClock(time.Unix(0, 0)))
+	m := New(loop, luamod.NewCoroutines(loop), stats)
+	setup(m)
+
+	L := lua.NewState()
+	L.PreloadModule("executor", m.Exports())
+	if err := L.DoString(script); err != nil {
+		t.Error(err)
+	}
+	loop.Run()
+	<-loop.Done()
+	return L
+}
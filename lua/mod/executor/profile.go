@@ -0,0 +1,113 @@
+package executor
+
+import (
+	"math"
+	"time"
+)
+
+// Stage is a part of load profile during which target value is linearly
+// reached from the target of the previous stage.
+type Stage struct {
+	Duration time.Duration
+	Target   float64
+}
+
+// Profile describes how target value (number of virtual users or rate of
+// iterations) changes over time.
+type Profile struct {
+	Start  float64
+	Stages []Stage
+}
+
+// At returns target value at given time since the start of the profile.
+func (p Profile) At(t time.Duration) float64 {
+	from := p.Start
+	for _, s := range p.Stages {
+		if t < s.Duration {
+			return from + (s.Target-from)*float64(t)/float64(s.Duration)
+		}
+		t -= s.Duration
+		from = s.Target
+	}
+	return from
+}
+
+// Until returns time since the start of the profile at which integral of the
+// target value over time in seconds reaches x. For rate profile it is a time
+// when x-th event should happen. It returns false if profile ends before.
+func (p Profile) Until(x float64) (time.Duration, bool) {
+	var (
+		from = p.Start
+		base time.Duration
+	)
+	for _, s := range p.Stages {
+		d := s.Duration.Seconds()
+		area := (from + s.Target) / 2 * d
+		if x <= area {
+			// Solve from*t + k*t^2 = x, where k is a half of the slope.
+			var t float64
+			k := (s.Target - from) / (2 * d)
+			switch {
+			case k == 0 && from == 0:
+				t = 0
+			case k == 0:
+				t = x / from
+			default:
+				t = (-from + math.Sqrt(math.Max(0, from*from+4*k*x))) / (2 * k)
+			}
+			return base + time.Duration(t*float64(time.Second)), true
+		}
+		x -= area
+		base += s.Duration
+		from = s.Target
+	}
+	return 0, false
+}
+
+// Duration returns total duration of the profile.
+func (p Profile) Duration() (d time.Duration) {
+	for _, s := range p.Stages {
+		d += s.Duration
+	}
+	return
+}
+
+// Max returns maximum target value of the profile.
+func (p Profile) Max() float64 {
+	max := p.Start
+	for _, s := range p.Stages {
+		if s.Target > max {
+			max = s.Target
+		}
+	}
+	return max
+}
+
+// Share is a part of the load given to one of Count threads.
+type Share struct {
+	Index int
+	Count int
+}
+
+// Of returns part of n given to the share. Parts of all shares sum up to n.
+func (s Share) Of(n int) int {
+	if n <= s.Index {
+		return 0
+	}
+	return (n - s.Index + s.Count - 1) / s.Count
+}
+
+// ID returns global 1-based identifier of the k-th (0-based) item of the
+// share.
+func (s Share) ID(k int) int {
+	return k*s.Count + s.Index + 1
+}
+
+// Part returns p-th part of the share, for example share of a thread within
+// share of an agent.
+func (s Share) Part(p Share) Share {
+	return Share{
+		Index: s.Index + s.Count*p.Index,
+		Count: s.Count * p.Count,
+	}
+}
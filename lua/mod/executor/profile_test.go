@@ -0,0 +1,110 @@
+package executor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProfileAt(t *testing.T) {
+	p := Profile{
+		Start: 10,
+		Stages: []Stage{
+			{Duration: 2 * time.Minute, Target: 1000},
+			{Duration: 10 * time.Minute, Target: 1000},
+			{Duration: time.Minute, Target: 0},
+		},
+	}
+	for _, test := range []struct {
+		at  time.Duration
+		exp float64
+	}{
+		{0, 10},
+		{time.Minute, 505},
+		{time.Second, 10 + 990.0/120},
+		{2 * time.Minute, 1000},
+		{7 * time.Minute, 1000},
+		{12*time.Minute + 30*time.Second, 500},
+		{13 * time.Minute, 0},
+		{time.Hour, 0},
+	} {
+		if act := p.At(test.at); act != test.exp {
+			t.Errorf("At(%s) = %v; want %v", test.at, act, test.exp)
+		}
+	}
+	if d := p.Duration(); d != 13*time.Minute {
+		t.Errorf("Duration() = %s; want %s", d, 13*time.Minute)
+	}
+	if m := p.Max(); m != 1000 {
+		t.Errorf("Max() = %v; want 1000", m)
+	}
+}
+
+func TestProfileUntil(t *testing.T) {
+	// Rate grows from 0 to 10 per second during 10 seconds, then holds.
+	p := Profile{
+		Stages: []Stage{
+			{Duration: 10 * time.Second, Target: 10},
+			{Duration: 10 * time.Second, Target: 10},
+		},
+	}
+	for _, test := range []struct {
+		x   float64
+		exp time.Duration
+		ok  bool
+	}{
+		{0, 0, true},
+		{12.5, time.Second * 5, true},
+		{50, time.Second * 10, true},
+		{60, time.Second * 11, true},
+		{150, time.Second * 20, true},
+		{151, 0, false},
+	} {
+		act, ok := p.Until(test.x)
+		if ok != test.ok || (act-test.exp).Round(time.Millisecond) != 0 {
+			t.Errorf("Until(%v) = %s, %t; want %s, %t", test.x, act, ok, test.exp, test.ok)
+		}
+	}
+}
+
+func TestShare(t *testing.T) {
+	for _, n := range []int{0, 1, 3, 4, 10, 1001} {
+		const count = 4
+		var sum int
+		seen := make(map[int]bool)
+		for i := 0; i < count; i++ {
+			s := Share{Index: i, Count: count}
+			part := s.Of(n)
+			sum += part
+			for k := 0; k < part; k++ {
+				seen[s.ID(k)] = true
+			}
+		}
+		if sum != n {
+			t.Errorf("sum of shares of %d is %d", n, sum)
+		}
+		for id := 1; id <= n; id++ {
+			if !seen[id] {
+				t.Errorf("id %d of %d is not given to any share", id, n)
+			}
+		}
+	}
+}
+
+func TestSharePart(t *testing.T) {
+	const n, agents, threads = 100, 3, 4
+	seen := make(map[int]int)
+	for a := 0; a < agents; a++ {
+		agent := Share{Index: a, Count: agents}
+		for i := 0; i < threads; i++ {
+			s := agent.Part(Share{Index: i, Count: threads})
+			for k := 0; k < s.Of(n); k++ {
+				seen[s.ID(k)]++
+			}
+		}
+	}
+	for id := 1; id <= n; id++ {
+		if seen[id] != 1 {
+			t.Errorf("id %d is given to %d parts; want 1", id, seen[id])
+		}
+	}
+}
@@ -0,0 +1,231 @@
+// Package fs brings lua module for reading and writing files inside of
+// allowed directories.
+package fs
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// maxLineSize limits size of line read by lines() and iter().
+const maxLineSize = 16 << 20
+
+// Mod is a "fs" lua module. Relative paths are resolved against the script
+// directory. All paths must point inside of one of the roots.
+type Mod struct {
+	dir   string
+	roots []string
+}
+
+// New creates module for script placed in dir. If roots are empty, dir is
+// used as the only root.
+func New(dir string, roots []string) (*Mod, error) {
+	dir, err := realpath(dir)
+	if err != nil {
+		return nil, err
+	}
+	m := &Mod{dir: dir}
+	if len(roots) == 0 {
+		roots = []string{dir}
+	}
+	for _, root := range roots {
+		r, err := realpath(root)
+		if err != nil {
+			return nil, err
+		}
+		m.roots = append(m.roots, r)
+	}
+	return m, nil
+}
+
+func (m *Mod) Exports() lua.LGFunction {
+	return func(L *lua.LState) int {
+		mod := L.NewTable()
+
+		mod.RawSetString("dir", lua.LString(m.dir))
+
+		// read(path) returns file contents and error.
+		mod.RawSetString("read", L.NewClosure(func(L *lua.LState) int {
+			path, err := m.resolve(L.CheckString(1))
+			if err != nil {
+				return pushError(L, err)
+			}
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return pushError(L, err)
+			}
+			L.Push(lua.LString(data))
+			return 1
+		}))
+
+		// lines(path) returns array of file lines and error.
+		mod.RawSetString("lines", L.NewClosure(func(L *lua.LState) int {
+			path, err := m.resolve(L.CheckString(1))
+			if err != nil {
+				return pushError(L, err)
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				return pushError(L, err)
+			}
+			defer f.Close()
+
+			table := L.NewTable()
+			s := newScanner(f)
+			for s.Scan() {
+				table.Append(lua.LString(s.Text()))
+			}
+			if err := s.Err(); err != nil {
+				return pushError(L, err)
+			}
+			L.Push(table)
+			return 1
+		}))
+
+		// iter(path) returns iterator over file lines and error. File is
+		// closed when iteration is done:
+		//
+		//	for line in fs.iter("payload.txt") do ... end
+		mod.RawSetString("iter", L.NewClosure(func(L *lua.LState) int {
+			path, err := m.resolve(L.CheckString(1))
+			if err != nil {
+				return pushError(L, err)
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				return pushError(L, err)
+			}
+			s := newScanner(f)
+			L.Push(L.NewClosure(func(L *lua.LState) int {
+				if f == nil {
+					return 0
+				}
+				if s.Scan() {
+					L.Push(lua.LString(s.Text()))
+					return 1
+				}
+				f.Close()
+				f = nil
+				if err := s.Err(); err != nil {
+					L.RaiseError("%s", err)
+				}
+				return 0
+			}))
+			return 1
+		}))
+
+		// write(path, data) and append(path, data) return error.
+		mod.RawSetString("write", L.NewClosure(func(L *lua.LState) int {
+			return m.writeFile(L, os.O_TRUNC)
+		}))
+		mod.RawSetString("append", L.NewClosure(func(L *lua.LState) int {
+			return m.writeFile(L, os.O_APPEND)
+		}))
+
+		// readdir([path]) returns sorted array of entry names and error. Path
+		// is the script directory by default.
+		mod.RawSetString("readdir", L.NewClosure(func(L *lua.LState) int {
+			path, err := m.resolve(L.OptString(1, "."))
+			if err != nil {
+				return pushError(L, err)
+			}
+			infos, err := ioutil.ReadDir(path)
+			if err != nil {
+				return pushError(L, err)
+			}
+			table := L.CreateTable(len(infos), 0)
+			for _, info := range infos {
+				table.Append(lua.LString(info.Name()))
+			}
+			L.Push(table)
+			return 1
+		}))
+
+		L.Push(mod)
+		return 1
+	}
+}
+
+func (m *Mod) writeFile(L *lua.LState, flag int) int {
+	path, err := m.resolve(L.CheckString(1))
+	if err != nil {
+		L.Push(lua.LString(err.Error()))
+		return 1
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|flag, 0644)
+	if err == nil {
+		_, err = f.Write([]byte(L.CheckString(2)))
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		L.Push(lua.LString(err.Error()))
+		return 1
+	}
+	return 0
+}
+
+// resolve returns absolute path if it is inside of one of the roots.
+// Symbolic links are evaluated before the check and dangling ones are
+// refused, because creating a file through them could escape the roots.
+func (m *Mod) resolve(path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(m.dir, path)
+	}
+	real, err := realpath(path)
+	if err != nil {
+		return "", err
+	}
+	for _, root := range m.roots {
+		rel, err := filepath.Rel(root, real)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return real, nil
+		}
+	}
+	return "", fmt.Errorf("%s: path is outside of allowed roots", path)
+}
+
+// realpath returns absolute path with symbolic links evaluated. Path itself
+// may not exist, but its directory must. It returns error for a dangling
+// symbolic link, which target could not be evaluated.
+func realpath(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	real, err := filepath.EvalSymlinks(path)
+	if err == nil {
+		return real, nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+	dir, err := filepath.EvalSymlinks(filepath.Dir(path))
+	if err != nil {
+		return "", err
+	}
+	real = filepath.Join(dir, filepath.Base(path))
+	if _, err := os.Lstat(real); err == nil {
+		return "", fmt.Errorf("%s: dangling symbolic link", path)
+	}
+	return real, nil
+}
+
+func newScanner(f *os.File) *bufio.Scanner {
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 64<<10), maxLineSize)
+	return s
+}
+
+func pushError(L *lua.LState, err error) int {
+	L.Push(lua.LNil)
+	L.Push(lua.LString(err.Error()))
+	return 2
+}
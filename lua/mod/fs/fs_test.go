@@ -0,0 +1,53 @@
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	script := filepath.Join(dir, "script")
+	data := filepath.Join(dir, "data")
+	for _, d := range []string{script, data} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(dir, filepath.Join(script, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "outside", "pwned"), filepath.Join(script, "out")); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := New(script, []string{script, data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		path string
+		ok   bool
+	}{
+		{"payload.bin", true},
+		{"sub/../payload.bin", true},
+		{filepath.Join(data, "out.txt"), true},
+		{"../data/out.txt", true},
+		{"../secret", false},
+		{"/etc/passwd", false},
+		{"escape/secret", false},
+		{"out", false},
+	} {
+		_, err := m.resolve(test.path)
+		if (err == nil) != test.ok {
+			t.Errorf("resolve(%q) error is %v; want ok %v", test.path, err, test.ok)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gobwas/gws/ev"
+	evhttp "github.com/gobwas/gws/ev/http"
+	luamod "github.com/gobwas/gws/lua/mod"
+	"github.com/yuin/gopher-lua"
+)
+
+const jarTypeName = "http.jar"
+
+type Mod struct {
+	loop *ev.Loop
+}
+
+func New(loop *ev.Loop) *Mod {
+	return &Mod{
+		loop: loop,
+	}
+}
+
+func (m *Mod) Exports() lua.LGFunction {
+	return func(L *lua.LState) int {
+		mod := L.NewTable()
+
+		jarMeta := L.NewTypeMetatable(jarTypeName)
+		jarMethods := L.NewTable()
+		// jar:cookies(url) returns table of cookie names and values which
+		// would be sent to the url.
+		jarMethods.RawSetString("cookies", L.NewClosure(func(L *lua.LState) int {
+			jar := JarFromValue(L.Get(1))
+			u, err := url.Parse(L.ToString(2))
+			if jar == nil || err != nil {
+				L.Push(L.NewTable())
+				return 1
+			}
+			table := L.NewTable()
+			for _, c := range jar.Cookies(u) {
+				table.RawSetString(c.Name, lua.LString(c.Value))
+			}
+			L.Push(table)
+			return 1
+		}))
+		jarMeta.RawSetString("__index", jarMethods)
+
+		// jar() returns cookie jar which could be passed as "jar" option to
+		// http.request() and ws.connect().
+		mod.RawSetString("jar", L.NewClosure(func(L *lua.LState) int {
+			jar, _ := cookiejar.New(nil)
+			ud := L.NewUserData()
+			ud.Value = jar
+			L.SetMetatable(ud, jarMeta)
+			L.Push(ud)
+			return 1
+		}))
+
+		// request(opts, cb) makes request asynchronously; cb is called with
+		// error and response table.
+		mod.RawSetString("request", L.NewClosure(func(L *lua.LState) int {
+			opts := L.ToTable(1)
+			cb := L.ToFunction(2)
+
+			req, err := requestFromTable(opts)
+			if err != nil {
+				m.loop.Call(func() {
+					luamod.Call(L, cb, lua.LString(err.Error()), lua.LNil)
+				})
+				return 0
+			}
+
+			m.loop.Request(102, req, func(err error, data interface{}) {
+				if err != nil {
+					luamod.Call(L, cb, lua.LString(err.Error()), lua.LNil)
+					return
+				}
+				luamod.Call(L, cb, lua.LNil, responseToTable(L, data.(*evhttp.Response)))
+			})
+
+			return 0
+		}))
+
+		// requestSync(opts) makes request synchronously and returns response
+		// table and error.
+		mod.RawSetString("requestSync", L.NewClosure(func(L *lua.LState) int {
+			req, err := requestFromTable(L.ToTable(1))
+			if err != nil {
+				L.Push(lua.LNil)
+				L.Push(lua.LString(err.Error()))
+				return 2
+			}
+			resp, err := evhttp.Do(req)
+			if err != nil {
+				L.Push(lua.LNil)
+				L.Push(lua.LString(err.Error()))
+				return 2
+			}
+			L.Push(responseToTable(L, resp))
+			return 1
+		}))
+
+		L.Push(mod)
+		return 1
+	}
+}
+
+// JarFromValue returns cookie jar created by http.jar() or nil if v is not a
+// jar.
+func JarFromValue(v lua.LValue) http.CookieJar {
+	if ud, ok := v.(*lua.LUserData); ok {
+		if jar, ok := ud.Value.(*cookiejar.Jar); ok {
+			return jar
+		}
+	}
+	return nil
+}
+
+// requestFromTable reads "url", "method", "headers", "body", "timeout" (in
+// milliseconds) and "jar" options.
+func requestFromTable(opts *lua.LTable) (req evhttp.Request, err error) {
+	if opts == nil {
+		return req, errors.New("options table is expected")
+	}
+	u, ok := opts.RawGetString("url").(lua.LString)
+	if !ok {
+		return req, errors.New("url is expected to be a string in options table")
+	}
+	req.Url = string(u)
+
+	req.Method = http.MethodGet
+	if method, ok := opts.RawGetString("method").(lua.LString); ok {
+		req.Method = strings.ToUpper(string(method))
+	}
+	if h, ok := opts.RawGetString("headers").(*lua.LTable); ok {
+		req.Headers = make(http.Header)
+		h.ForEach(func(k, v lua.LValue) {
+			if k.Type() == lua.LTString {
+				req.Headers.Set(k.String(), v.String())
+			}
+		})
+	}
+	if body, ok := opts.RawGetString("body").(lua.LString); ok {
+		req.Body = []byte(body)
+	}
+	if ms, ok := opts.RawGetString("timeout").(lua.LNumber); ok {
+		req.Timeout = time.Duration(float64(ms) * float64(time.Millisecond))
+	}
+	req.Jar = JarFromValue(opts.RawGetString("jar"))
+
+	return req, nil
+}
+
+// responseToTable returns table with "status", "headers" and "body" fields.
+func responseToTable(L *lua.LState, resp *evhttp.Response) *lua.LTable {
+	headers := L.NewTable()
+	for key := range resp.Headers {
+		headers.RawSetString(key, lua.LString(resp.Headers.Get(key)))
+	}
+	table := L.NewTable()
+	table.RawSetString("status", lua.LNumber(resp.Status))
+	table.RawSetString("headers", headers)
+	table.RawSetString("body", lua.LString(resp.Body))
+	return table
+}
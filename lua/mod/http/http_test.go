@@ -0,0 +1,122 @@
+package http
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gobwas/gws/ev"
+	evhttp "github.com/gobwas/gws/ev/http"
+	luamod "github.com/gobwas/gws/lua/mod"
+	"github.com/yuin/gopher-lua"
+)
+
+func testServer() *httptest.Server {
+	mux := http.NewServeMux()
+	// echo replies with method, header and body of the request.
+	mux.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("X-Method", r.Method)
+		w.Header().Set("X-Test", r.Header.Get("X-Test"))
+		w.WriteHeader(http.StatusCreated)
+		w.Write(body)
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	})
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc", Path: "/"})
+	})
+	mux.HandleFunc("/me", func(w http.ResponseWriter, r *http.Request) {
+		if c, err := r.Cookie("session"); err == nil {
+			w.Write([]byte(c.Value))
+		}
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestRequest(t *testing.T) {
+	srv := testServer()
+	defer srv.Close()
+
+	loop := ev.NewLoop()
+	loop.Register(evhttp.NewHandler(), 102)
+
+	L := lua.NewState()
+	defer L.Close()
+	luamod.SetErrorHandler(L, func(_ *lua.LState, err error) {
+		t.Errorf("lua error: %s", err)
+	})
+	L.PreloadModule("http", New(loop).Exports())
+	L.SetGlobal("url", lua.LString(srv.URL))
+	var events []string
+	L.SetGlobal("log", L.NewFunction(func(L *lua.LState) int {
+		var args []string
+		for i := 1; i <= L.GetTop(); i++ {
+			args = append(args, L.Get(i).String())
+		}
+		events = append(events, strings.Join(args, " "))
+		return 0
+	}))
+
+	err := L.DoString(`
+		local http = require("http")
+
+		http.request({
+			url = url .. "/echo",
+			method = "post",
+			headers = { ["X-Test"] = "1" },
+			body = "hello",
+		}, function(err, resp)
+			assert(err == nil, err)
+			log("echo", resp.status, resp.headers["X-Method"], resp.headers["X-Test"], resp.body)
+		end)
+
+		http.request({ url = url .. "/slow", timeout = 50 }, function(err, resp)
+			log("slow", err ~= nil, resp)
+		end)
+
+		http.request({ method = "get" }, function(err, resp)
+			log("no url", err, resp)
+		end)
+
+		local jar = http.jar()
+		local resp, err = http.requestSync({ url = url .. "/login", jar = jar })
+		assert(err == nil, err)
+		log("cookies", jar:cookies(url).session)
+		log("with jar", http.requestSync({ url = url .. "/me", jar = jar }).body)
+		log("without jar", http.requestSync({ url = url .. "/me" }).body)
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loop.Run()
+	select {
+	case <-loop.Done():
+	case <-time.After(5 * time.Second):
+		loop.Shutdown()
+		t.Fatalf("requests are not finished; events: %q", events)
+	}
+
+	// Asynchronous responses could arrive in any order.
+	want := []string{
+		"cookies abc",
+		"echo 201 POST 1 hello",
+		"no url url is expected to be a string in options table nil",
+		"slow true nil",
+		"with jar abc",
+		"without jar ",
+	}
+	sort.Strings(events)
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("got events:\n%q\nwant:\n%q", events, want)
+	}
+}
@@ -0,0 +1,238 @@
+// Package json brings lua module for encoding and decoding json.
+package json
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// typeField is a metatable field that marks table as json array or object.
+const typeField = "__jsontype"
+
+const (
+	typeArray  = "array"
+	typeObject = "object"
+)
+
+// maxDepth limits nesting of encoded tables to catch reference cycles.
+const maxDepth = 1000
+
+// Mod is a "json" lua module.
+//
+// Tables are encoded as arrays when they are marked by json.array() or when
+// they have only sequential integer keys starting from 1. Empty tables are
+// encoded as objects unless marked by json.array(). Decoded arrays and objects
+// are marked, so they are encoded back the same way. The json.null value
+// represents json null inside of tables.
+type Mod struct{}
+
+func New() *Mod {
+	return &Mod{}
+}
+
+func (m *Mod) Exports() lua.LGFunction {
+	return func(L *lua.LState) int {
+		mod := L.NewTable()
+
+		null := L.NewUserData()
+		arrayMeta := L.NewTable()
+		arrayMeta.RawSetString(typeField, lua.LString(typeArray))
+		objectMeta := L.NewTable()
+		objectMeta.RawSetString(typeField, lua.LString(typeObject))
+
+		mod.RawSetString("null", null)
+
+		// encode(value[, opts]) returns string and error.
+		// opts is a table with optional "indent" string field.
+		mod.RawSetString("encode", L.NewClosure(func(L *lua.LState) int {
+			e := encoder{L: L, null: null}
+			v, err := e.toGo(L.Get(1), 0)
+			if err == nil {
+				var data []byte
+				indent := ""
+				if opts := L.ToTable(2); opts != nil {
+					indent = lua.LVAsString(opts.RawGetString("indent"))
+				}
+				if data, err = marshal(v, indent); err == nil {
+					L.Push(lua.LString(data))
+					return 1
+				}
+			}
+			L.Push(lua.LNil)
+			L.Push(lua.LString(err.Error()))
+			return 2
+		}))
+
+		// decode(string) returns value and error.
+		mod.RawSetString("decode", L.NewClosure(func(L *lua.LState) int {
+			d := json.NewDecoder(bytes.NewReader([]byte(L.ToString(1))))
+			d.UseNumber()
+			var v interface{}
+			err := d.Decode(&v)
+			if err == nil && d.More() {
+				err = errors.New("json: unexpected data after top-level value")
+			}
+			if err != nil {
+				L.Push(lua.LNil)
+				L.Push(lua.LString(err.Error()))
+				return 2
+			}
+			dec := decoder{L: L, null: null, arrayMeta: arrayMeta, objectMeta: objectMeta}
+			L.Push(dec.fromGo(v))
+			return 1
+		}))
+
+		// array([table]) and object([table]) mark table to be encoded as json
+		// array or object. They return given or new table.
+		mark := func(meta *lua.LTable) *lua.LFunction {
+			return L.NewClosure(func(L *lua.LState) int {
+				t := L.OptTable(1, L.NewTable())
+				L.SetMetatable(t, meta)
+				L.Push(t)
+				return 1
+			})
+		}
+		mod.RawSetString("array", mark(arrayMeta))
+		mod.RawSetString("object", mark(objectMeta))
+
+		L.Push(mod)
+		return 1
+	}
+}
+
+func marshal(v interface{}, indent string) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", indent)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte{'\n'}), nil
+}
+
+type encoder struct {
+	L    *lua.LState
+	null *lua.LUserData
+}
+
+func (e encoder) toGo(v lua.LValue, depth int) (interface{}, error) {
+	switch x := v.(type) {
+	case *lua.LNilType:
+		return nil, nil
+	case lua.LBool:
+		return bool(x), nil
+	case lua.LString:
+		return string(x), nil
+	case lua.LNumber:
+		f := float64(x)
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, fmt.Errorf("json: unsupported number %v", f)
+		}
+		return json.Number(strconv.FormatFloat(f, 'g', -1, 64)), nil
+	case *lua.LUserData:
+		if x == e.null {
+			return nil, nil
+		}
+	case *lua.LTable:
+		if depth >= maxDepth {
+			return nil, errors.New("json: table is nested too deeply or has a reference cycle")
+		}
+		return e.table(x, depth+1)
+	}
+	return nil, fmt.Errorf("json: unsupported value type %s", v.Type())
+}
+
+func (e encoder) table(t *lua.LTable, depth int) (interface{}, error) {
+	var kind string
+	if meta, ok := e.L.GetMetatable(t).(*lua.LTable); ok {
+		kind = lua.LVAsString(meta.RawGetString(typeField))
+	}
+	if kind == "" {
+		kind = typeObject
+		if n := t.MaxN(); n > 0 && n == count(t) {
+			kind = typeArray
+		}
+	}
+
+	if kind == typeArray {
+		n := t.MaxN()
+		arr := make([]interface{}, n)
+		for i := 1; i <= n; i++ {
+			v, err := e.toGo(t.RawGetInt(i), depth)
+			if err != nil {
+				return nil, err
+			}
+			arr[i-1] = v
+		}
+		return arr, nil
+	}
+
+	obj := make(map[string]interface{})
+	var err error
+	t.ForEach(func(key, value lua.LValue) {
+		if err != nil {
+			return
+		}
+		var k string
+		switch key.(type) {
+		case lua.LString, lua.LNumber:
+			k = key.String()
+		default:
+			err = fmt.Errorf("json: unsupported object key type %s", key.Type())
+			return
+		}
+		obj[k], err = e.toGo(value, depth)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+func count(t *lua.LTable) (n int) {
+	t.ForEach(func(_, _ lua.LValue) { n++ })
+	return
+}
+
+type decoder struct {
+	L          *lua.LState
+	null       *lua.LUserData
+	arrayMeta  *lua.LTable
+	objectMeta *lua.LTable
+}
+
+func (d decoder) fromGo(v interface{}) lua.LValue {
+	switch x := v.(type) {
+	case nil:
+		return d.null
+	case bool:
+		return lua.LBool(x)
+	case string:
+		return lua.LString(x)
+	case json.Number:
+		f, _ := strconv.ParseFloat(string(x), 64)
+		return lua.LNumber(f)
+	case []interface{}:
+		t := d.L.CreateTable(len(x), 0)
+		for _, v := range x {
+			t.Append(d.fromGo(v))
+		}
+		d.L.SetMetatable(t, d.arrayMeta)
+		return t
+	case map[string]interface{}:
+		t := d.L.CreateTable(0, len(x))
+		for k, v := range x {
+			t.RawSetString(k, d.fromGo(v))
+		}
+		d.L.SetMetatable(t, d.objectMeta)
+		return t
+	}
+	return lua.LNil
+}
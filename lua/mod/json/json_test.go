@@ -0,0 +1,54 @@
+package json
+
+import (
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestJSON(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+	L.PreloadModule("json", New().Exports())
+
+	err := L.DoString(`
+		local json = require("json")
+
+		local function check(value, exp)
+			local str, err = json.encode(value)
+			assert(err == nil, err)
+			assert(str == exp, "encode: got " .. tostring(str) .. "; want " .. exp)
+		end
+
+		check({1, 2, "three"}, '[1,2,"three"]')
+		check({a = 1.5}, '{"a":1.5}')
+		check({}, '{}')
+		check(json.array(), '[]')
+		check({a = json.null, b = true}, '{"a":null,"b":true}')
+		check("<&>", '"<&>"')
+
+		local v, err = json.decode('{"list":[],"obj":{},"n":null,"x":[1,{"y":"z"}]}')
+		assert(err == nil, err)
+		assert(v.n == json.null)
+		assert(v.x[1] == 1 and v.x[2].y == "z")
+		check(v.list, '[]')
+		check(v.obj, '{}')
+
+		local _, err = json.decode('{"a":')
+		assert(err ~= nil)
+		local _, err = json.decode('{} {}')
+		assert(err ~= nil)
+		local _, err = json.encode({f = function() end})
+		assert(err ~= nil)
+		local _, err = json.encode(0/0)
+		assert(err ~= nil)
+
+		local cycle = {}
+		cycle.self = cycle
+		local _, err = json.encode(cycle)
+		assert(err ~= nil)
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
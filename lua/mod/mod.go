@@ -32,7 +32,7 @@ func (s *Storage) Get(key string) (result interface{}) {
 func (s *Storage) ExportSet(L *lua.LState) *lua.LFunction {
 	return L.NewClosure(func(L *lua.LState) int {
 		key := L.ToString(1)
-		value := L.Get(3)
+		value := L.Get(2)
 		s.Set(key, value)
 		return 0
 	})
@@ -63,6 +63,10 @@ func (s *Storage) ExportGet(L *lua.LState) *lua.LFunction {
 	})
 }
 
+// Value could be emitted to pass arbitrary value which is created by the
+// state of listener.
+type Value func(*lua.LState) lua.LValue
+
 type Emitter struct {
 	seq       uint32
 	callbacks map[string][]*callback
@@ -85,6 +89,11 @@ func (e *Emitter) Emit(name string, args ...interface{}) {
 	}
 }
 
+// Listeners returns number of callbacks registered for the event.
+func (e *Emitter) Listeners(event string) int {
+	return len(e.callbacks[event])
+}
+
 func (e *Emitter) On(event string, cb func(...interface{})) uint32 {
 	e.seq++
 	e.callbacks[event] = append(e.callbacks[event], &callback{e.seq, cb})
@@ -96,7 +105,7 @@ func (e *Emitter) Off(id uint32) {
 		for i, cb := range callbacks {
 			if cb.id == id {
 				copy(callbacks[i:], callbacks[i+1:])
-				last := len(callbacks) + 1
+				last := len(callbacks) - 1
 				callbacks[last] = nil
 				e.callbacks[evt] = callbacks[:last]
 				return
@@ -121,15 +130,13 @@ func (e *Emitter) ExportOn(L *lua.LState) *lua.LFunction {
 					callArgs = append(callArgs, lua.LNumber(v))
 				case float64:
 					callArgs = append(callArgs, lua.LNumber(v))
+				case Value:
+					callArgs = append(callArgs, v(L))
 				default:
 					//
 				}
 			}
-			L.CallByParam(lua.P{
-				Fn:      cb,
-				NRet:    0,
-				Protect: false,
-			}, callArgs...)
+			Call(L, cb, callArgs...)
 		})
 		return 0
 	})
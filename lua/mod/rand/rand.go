@@ -0,0 +1,153 @@
+// Package rand brings lua module with seedable random generator.
+package rand
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/yuin/gopher-lua"
+)
+
+const alphanumeric = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// Mod is a "rand" lua module. Module functions use generator seeded with the
+// seed given to New; rand.new(seed) returns independent generator with the
+// same functions.
+type Mod struct {
+	seed int64
+}
+
+func New(seed int64) *Mod {
+	return &Mod{seed}
+}
+
+func (m *Mod) Exports() lua.LGFunction {
+	return func(L *lua.LState) int {
+		r := rand.New(rand.NewSource(m.seed))
+		mod := generator(L, r)
+
+		// seed(n) reseeds module generator.
+		mod.RawSetString("seed", L.NewClosure(func(L *lua.LState) int {
+			r.Seed(int64(L.CheckNumber(1)))
+			return 0
+		}))
+
+		// new(seed) returns new generator.
+		mod.RawSetString("new", L.NewClosure(func(L *lua.LState) int {
+			seed := int64(L.CheckNumber(1))
+			L.Push(generator(L, rand.New(rand.NewSource(seed))))
+			return 1
+		}))
+
+		L.Push(mod)
+		return 1
+	}
+}
+
+func generator(L *lua.LState, r *rand.Rand) *lua.LTable {
+	table := L.NewTable()
+
+	// int([m, ]n) returns integer in [m, n]; m is 1 by default.
+	table.RawSetString("int", L.NewClosure(func(L *lua.LState) int {
+		min, max := int64(1), int64(L.CheckNumber(1))
+		if L.GetTop() > 1 {
+			min, max = max, int64(L.CheckNumber(2))
+		}
+		if min > max {
+			L.ArgError(1, "interval is empty")
+		}
+		// Size of the interval overflows for bounds far from each other.
+		n := max - min + 1
+		if n <= 0 {
+			L.ArgError(1, "interval is too large")
+		}
+		L.Push(lua.LNumber(min + r.Int63n(n)))
+		return 1
+	}))
+
+	// float() returns number in [0, 1).
+	table.RawSetString("float", L.NewClosure(func(L *lua.LState) int {
+		L.Push(lua.LNumber(r.Float64()))
+		return 1
+	}))
+
+	// bytes(n) returns string of n random bytes.
+	table.RawSetString("bytes", L.NewClosure(func(L *lua.LState) int {
+		p := make([]byte, L.CheckInt(1))
+		r.Read(p)
+		L.Push(lua.LString(p))
+		return 1
+	}))
+
+	// string(n[, alphabet]) returns string of n random characters of
+	// alphabet, which is alphanumeric by default.
+	table.RawSetString("string", L.NewClosure(func(L *lua.LState) int {
+		n := L.CheckInt(1)
+		alphabet := []rune(L.OptString(2, alphanumeric))
+		if len(alphabet) == 0 {
+			L.ArgError(2, "alphabet is empty")
+		}
+		p := make([]rune, n)
+		for i := range p {
+			p[i] = alphabet[r.Intn(len(alphabet))]
+		}
+		L.Push(lua.LString(string(p)))
+		return 1
+	}))
+
+	// uuid() returns random (version 4) uuid.
+	table.RawSetString("uuid", L.NewClosure(func(L *lua.LState) int {
+		var u [16]byte
+		r.Read(u[:])
+		u[6] = (u[6] & 0x0f) | 0x40
+		u[8] = (u[8] & 0x3f) | 0x80
+		L.Push(lua.LString(fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:])))
+		return 1
+	}))
+
+	// choice(items[, weights]) returns random element of items array.
+	// Optional weights array makes choice weighted.
+	table.RawSetString("choice", L.NewClosure(func(L *lua.LState) int {
+		items := L.CheckTable(1)
+		n := items.Len()
+		if n == 0 {
+			L.Push(lua.LNil)
+			return 1
+		}
+		weights := L.OptTable(2, nil)
+		if weights == nil {
+			L.Push(items.RawGetInt(1 + r.Intn(n)))
+			return 1
+		}
+
+		var total float64
+		for i := 1; i <= n; i++ {
+			w, ok := weights.RawGetInt(i).(lua.LNumber)
+			if !ok || w < 0 {
+				L.ArgError(2, fmt.Sprintf("weight #%d is not a non-negative number", i))
+			}
+			total += float64(w)
+		}
+		if total == 0 {
+			L.ArgError(2, "sum of weights is zero")
+		}
+		x := r.Float64() * total
+		for i := 1; i <= n; i++ {
+			x -= float64(weights.RawGetInt(i).(lua.LNumber))
+			if x < 0 {
+				L.Push(items.RawGetInt(i))
+				return 1
+			}
+		}
+		// Floating point rounding could leave x a bit above zero.
+		for i := n; i > 0; i-- {
+			if weights.RawGetInt(i).(lua.LNumber) > 0 {
+				L.Push(items.RawGetInt(i))
+				break
+			}
+		}
+		return 1
+	}))
+
+	return table
+}
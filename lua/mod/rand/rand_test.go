@@ -0,0 +1,46 @@
+package rand
+
+import (
+	"testing"
+	"unicode/utf8"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestRand(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+	L.PreloadModule("rand", New(42).Exports())
+
+	err := L.DoString(`
+		local rand = require("rand")
+
+		for i = 1, 100 do
+			local x = rand.int(-2, 2)
+			assert(x >= -2 and x <= 2 and x == math.floor(x), "int out of interval: " .. x)
+			local y = rand.int(3)
+			assert(y >= 1 and y <= 3, "int out of interval: " .. y)
+		end
+		assert(not pcall(rand.int, 2, 1))
+		assert(not pcall(rand.int, -2^62 * 1.5, 2^62 * 1.5))
+
+		local a, b = rand.new(7), rand.new(7)
+		for i = 1, 10 do
+			assert(a.int(1000) == b.int(1000), "generators with the same seed differ")
+		end
+
+		assert(#rand.string(16) == 16)
+		assert(#rand.bytes(5) == 5)
+		assert(string.match(rand.uuid(), "^%x+-%x+-4%x+-[89ab]%x+-%x+$"))
+		assert(rand.choice({"a", "b"}, {0, 1}) == "b")
+
+		s = rand.string(100, "абв")
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := lua.LVAsString(L.GetGlobal("s"))
+	if !utf8.ValidString(s) || utf8.RuneCountInString(s) != 100 {
+		t.Errorf("rand.string with multi-byte alphabet returned %q", s)
+	}
+}
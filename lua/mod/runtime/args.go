@@ -0,0 +1,118 @@
+package runtime
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// Args holds script arguments passed from the command line.
+type Args map[string]string
+
+// ParseArgs builds Args from "key=value" pairs and from positional arguments
+// in form of "--key=value" or "--key". The latter is treated as "key=true".
+func ParseArgs(pairs, positional []string) (Args, error) {
+	args := make(Args, len(pairs)+len(positional))
+	for _, p := range pairs {
+		i := strings.IndexByte(p, '=')
+		if i <= 0 {
+			return nil, fmt.Errorf("malformed script argument %q: want key=value", p)
+		}
+		args[p[:i]] = p[i+1:]
+	}
+	for _, p := range positional {
+		if !strings.HasPrefix(p, "--") || len(p) == 2 {
+			return nil, fmt.Errorf("malformed script argument %q: want --key[=value]", p)
+		}
+		p = p[2:]
+		if i := strings.IndexByte(p, '='); i > 0 {
+			args[p[:i]] = p[i+1:]
+		} else {
+			args[p] = "true"
+		}
+	}
+	return args, nil
+}
+
+// ParseBytes parses size with optional k, m or g suffix (case insensitive,
+// with optional trailing "b").
+func ParseBytes(s string) (int64, error) {
+	str := strings.TrimSuffix(strings.ToLower(s), "b")
+	mul := int64(1)
+	if n := len(str); n > 0 {
+		switch str[n-1] {
+		case 'k':
+			mul = 1 << 10
+		case 'm':
+			mul = 1 << 20
+		case 'g':
+			mul = 1 << 30
+		}
+		if mul != 1 {
+			str = str[:n-1]
+		}
+	}
+	n, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return 0, fmt.Errorf("malformed size %q", s)
+	}
+	return int64(n * float64(mul)), nil
+}
+
+// ToTable returns lua table with getters. Each getter receives the key and
+// optional default value and returns value and error if value is malformed.
+// Duration is returned in milliseconds.
+func (a Args) ToTable(L *lua.LState) *lua.LTable {
+	table := L.NewTable()
+
+	getter := func(parse func(string) (lua.LValue, error)) *lua.LFunction {
+		return L.NewClosure(func(L *lua.LState) int {
+			str, ok := a[L.ToString(1)]
+			if !ok {
+				L.Push(L.Get(2))
+				return 1
+			}
+			v, err := parse(str)
+			if err != nil {
+				L.Push(lua.LNil)
+				L.Push(lua.LString(fmt.Sprintf("argument %q: %s", L.ToString(1), err)))
+				return 2
+			}
+			L.Push(v)
+			return 1
+		})
+	}
+
+	table.RawSetString("get", getter(func(s string) (lua.LValue, error) {
+		return lua.LString(s), nil
+	}))
+	table.RawSetString("number", getter(func(s string) (lua.LValue, error) {
+		n, err := strconv.ParseFloat(s, 64)
+		return lua.LNumber(n), err
+	}))
+	table.RawSetString("bool", getter(func(s string) (lua.LValue, error) {
+		b, err := strconv.ParseBool(s)
+		return lua.LBool(b), err
+	}))
+	table.RawSetString("bytes", getter(func(s string) (lua.LValue, error) {
+		n, err := ParseBytes(s)
+		return lua.LNumber(n), err
+	}))
+	table.RawSetString("duration", getter(func(s string) (lua.LValue, error) {
+		d, err := time.ParseDuration(s)
+		return lua.LNumber(float64(d) / float64(time.Millisecond)), err
+	}))
+	table.RawSetString("all", L.NewClosure(func(L *lua.LState) int {
+		all := L.NewTable()
+		for key, value := range a {
+			all.RawSetString(key, lua.LString(value))
+		}
+		L.Push(all)
+		return 1
+	}))
+
+	return table
+}
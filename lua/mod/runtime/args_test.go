@@ -0,0 +1,49 @@
+package runtime
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseArgs(t *testing.T) {
+	args, err := ParseArgs(
+		[]string{"conns=500", "url=ws://a?b=c"},
+		[]string{"--payload=1k", "--verbose"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := Args{"conns": "500", "url": "ws://a?b=c", "payload": "1k", "verbose": "true"}
+	if !reflect.DeepEqual(args, exp) {
+		t.Errorf("ParseArgs() = %v; want %v", args, exp)
+	}
+	for _, bad := range [][]string{{"=1"}, {"conns"}} {
+		if _, err := ParseArgs(bad, nil); err == nil {
+			t.Errorf("ParseArgs(%q) = nil error; want error", bad)
+		}
+	}
+	if _, err := ParseArgs(nil, []string{"payload"}); err == nil {
+		t.Errorf("ParseArgs() with positional without dashes = nil error; want error")
+	}
+}
+
+func TestParseBytes(t *testing.T) {
+	for _, test := range []struct {
+		in  string
+		out int64
+		err bool
+	}{
+		{"10", 10, false},
+		{"1k", 1 << 10, false},
+		{"1KB", 1 << 10, false},
+		{"1.5m", 3 << 19, false},
+		{"2g", 2 << 30, false},
+		{"k", 0, true},
+		{"ten", 0, true},
+	} {
+		n, err := ParseBytes(test.in)
+		if n != test.out || (err != nil) != test.err {
+			t.Errorf("ParseBytes(%q) = %d, %v; want %d (error %v)", test.in, n, err, test.out, test.err)
+		}
+	}
+}
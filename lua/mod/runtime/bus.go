@@ -0,0 +1,59 @@
+package runtime
+
+import (
+	"fmt"
+	"sync"
+)
+
+// MasterID is an identifier of master thread on the Bus.
+const MasterID = -1
+
+// Bus passes messages between runtimes of different threads.
+type Bus struct {
+	mu        sync.RWMutex
+	receivers map[int]func(from int, value interface{})
+}
+
+func NewBus() *Bus {
+	return &Bus{
+		receivers: make(map[int]func(int, interface{})),
+	}
+}
+
+// Register makes runtime to receive messages sent to id.
+func (b *Bus) Register(id int, r *Runtime) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.receivers[id] = r.deliver
+}
+
+// Unregister stops delivering messages sent to id.
+func (b *Bus) Unregister(id int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.receivers, id)
+}
+
+// Send delivers value to the thread with given id. Value must be obtained
+// from util.ToGo().
+func (b *Bus) Send(from, to int, value interface{}) error {
+	b.mu.RLock()
+	deliver, ok := b.receivers[to]
+	b.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("thread %d is not running", to)
+	}
+	deliver(from, value)
+	return nil
+}
+
+// Broadcast delivers value to all threads except the sender.
+func (b *Bus) Broadcast(from int, value interface{}) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for id, deliver := range b.receivers {
+		if id != from {
+			deliver(from, value)
+		}
+	}
+}
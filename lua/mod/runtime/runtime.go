@@ -3,6 +3,7 @@ package runtime
 import (
 	"github.com/gobwas/gws/ev"
 	"github.com/gobwas/gws/lua/mod"
+	"github.com/gobwas/gws/lua/util"
 	"github.com/yuin/gopher-lua"
 	"runtime"
 	"sync/atomic"
@@ -16,22 +17,33 @@ type Runtime struct {
 	exported int32
 	initTime time.Time
 	loop     *ev.Loop
+	co       *mod.Coroutines
 	fork     forkFn
+	args     Args
+	opts     interface{}
+
+	id  int
+	bus *Bus
+	ref bool // loop is referenced by message listeners
 }
 
+const eventMessage = "message"
+
 type callback struct {
 	event string
 	fn    *lua.LFunction
 }
 
-type forkFn func() error
+// forkFn starts new thread with options obtained from util.ToGo().
+type forkFn func(opts interface{}) (*Thread, error)
 
-func New(loop *ev.Loop) *Runtime {
+func New(loop *ev.Loop, co *mod.Coroutines) *Runtime {
 	return &Runtime{
 		emitter:  mod.NewEmitter(),
 		storage:  mod.NewStorage(),
 		initTime: time.Now(),
 		loop:     loop,
+		co:       co,
 	}
 }
 
@@ -42,9 +54,47 @@ func (m *Runtime) SetForkFn(f forkFn) {
 	m.fork = f
 }
 
-func (m *Runtime) Emit(name string) {
+func (m *Runtime) SetArgs(args Args) {
+	m.args = args
+}
+
+// SetOpts sets options passed to runtime.fork() which created this thread.
+func (m *Runtime) SetOpts(opts interface{}) {
+	m.opts = opts
+}
+
+// SetBus registers runtime on the bus with given id.
+func (m *Runtime) SetBus(bus *Bus, id int) {
+	m.bus = bus
+	m.id = id
+	bus.Register(id, m)
+}
+
+func (m *Runtime) deliver(from int, value interface{}) {
 	m.loop.Call(func() {
-		m.emitter.Emit(name)
+		m.emitter.Emit(eventMessage, from, mod.Value(func(L *lua.LState) lua.LValue {
+			return util.FromGo(L, value)
+		}))
+	})
+}
+
+// updateRef keeps loop alive while there are message listeners.
+func (m *Runtime) updateRef() {
+	want := m.emitter.Listeners(eventMessage) > 0
+	if want == m.ref {
+		return
+	}
+	m.ref = want
+	if want {
+		m.loop.Ref()
+	} else {
+		m.loop.Unref()
+	}
+}
+
+func (m *Runtime) Emit(name string, args ...interface{}) {
+	m.loop.Call(func() {
+		m.emitter.Emit(name, args...)
 	})
 }
 
@@ -67,29 +117,149 @@ func (m *Runtime) Exports() lua.LGFunction {
 		mod := L.NewTable()
 
 		if m.fork != nil {
+			// fork([opts]) starts new thread and returns its handle and
+			// error. Options are available in thread as runtime.opts.
 			mod.RawSetString("fork", L.NewClosure(func(L *lua.LState) int {
-				if err := m.fork(); err != nil {
+				opts, err := util.ToGo(L.Get(1))
+				var t *Thread
+				if err == nil {
+					t, err = m.fork(opts)
+				}
+				if err != nil {
+					L.Push(lua.LNil)
 					L.Push(lua.LString(err.Error()))
-					return 1
+					return 2
 				}
-				return 0
+				L.Push(m.threadToTable(L, t))
+				return 1
 			}))
 		}
 
+		// spawn(fn, ...) calls fn in a coroutine, where blocking functions
+		// called without callbacks yield to the loop.
+		mod.RawSetString("spawn", L.NewClosure(func(L *lua.LState) int {
+			fn := L.CheckFunction(1)
+			var args []lua.LValue
+			for i := 2; i <= L.GetTop(); i++ {
+				args = append(args, L.Get(i))
+			}
+			if err := m.co.Spawn(L, fn, args...); err != nil {
+				L.Push(lua.LString(err.Error()))
+				return 1
+			}
+			return 0
+		}))
+
+		if m.opts != nil {
+			mod.RawSetString("opts", util.FromGo(L, m.opts))
+		}
+
 		mod.RawSetString("isMaster", L.NewClosure(func(L *lua.LState) int {
 			L.Push(lua.LBool(m.fork != nil))
 			return 1
 		}))
 
+		mod.RawSetString("args", L.NewClosure(func(L *lua.LState) int {
+			L.Push(m.args.ToTable(L))
+			return 1
+		}))
+
 		mod.RawSetString("numCPU", lua.LNumber(runtime.NumCPU()))
 
 		mod.RawSetString("set", m.storage.ExportSet(L))
 		mod.RawSetString("get", m.storage.ExportGet(L))
 
-		mod.RawSetString("on", m.emitter.ExportOn(L))
-		mod.RawSetString("off", m.emitter.ExportOff(L))
+		if m.bus != nil {
+			mod.RawSetString("id", lua.LNumber(m.id))
+			mod.RawSetString("masterId", lua.LNumber(MasterID))
+
+			// send(id, value) sends value to the thread with given id.
+			mod.RawSetString("send", L.NewClosure(func(L *lua.LState) int {
+				to := L.CheckInt(1)
+				value, err := util.ToGo(L.Get(2))
+				if err == nil {
+					err = m.bus.Send(m.id, to, value)
+				}
+				if err != nil {
+					L.Push(lua.LString(err.Error()))
+					return 1
+				}
+				return 0
+			}))
+
+			// broadcast(value) sends value to all other threads.
+			mod.RawSetString("broadcast", L.NewClosure(func(L *lua.LState) int {
+				value, err := util.ToGo(L.Get(1))
+				if err != nil {
+					L.Push(lua.LString(err.Error()))
+					return 1
+				}
+				m.bus.Broadcast(m.id, value)
+				return 0
+			}))
+		}
+
+		// Thread with "message" listeners is kept running until they are
+		// removed.
+		on, off := m.emitter.ExportOn(L), m.emitter.ExportOff(L)
+		mod.RawSetString("on", L.NewClosure(func(L *lua.LState) int {
+			n := on.GFunction(L)
+			m.updateRef()
+			return n
+		}))
+		mod.RawSetString("off", L.NewClosure(func(L *lua.LState) int {
+			n := off.GFunction(L)
+			m.updateRef()
+			return n
+		}))
 
 		L.Push(mod)
 		return 1
 	}
 }
+
+// threadToTable returns handle table with "id" field, "join(cb)", "kill()"
+// and "status()" functions. Status returns one of "running", "done", "failed"
+// or "killed" and script error of the thread. Callback of join is called with
+// the same values when thread finishes.
+func (m *Runtime) threadToTable(L *lua.LState, t *Thread) *lua.LTable {
+	table := L.NewTable()
+	table.RawSetString("id", lua.LNumber(t.ID))
+
+	status := func() (lua.LValue, lua.LValue) {
+		s, err := t.Status()
+		if err != nil {
+			return lua.LString(s), lua.LString(err.Error())
+		}
+		return lua.LString(s), lua.LNil
+	}
+
+	table.RawSetString("status", L.NewClosure(func(L *lua.LState) int {
+		s, err := status()
+		L.Push(s)
+		L.Push(err)
+		return 2
+	}))
+
+	table.RawSetString("kill", L.NewClosure(func(L *lua.LState) int {
+		t.Kill()
+		return 0
+	}))
+
+	table.RawSetString("join", L.NewClosure(func(L *lua.LState) int {
+		cb := L.CheckFunction(1)
+		// Keep loop alive until the thread finishes.
+		m.loop.Ref()
+		go func() {
+			<-t.Done()
+			m.loop.Call(func() {
+				m.loop.Unref()
+				s, err := status()
+				mod.Call(L, cb, s, err)
+			})
+		}()
+		return 0
+	}))
+
+	return table
+}
@@ -0,0 +1,84 @@
+package runtime
+
+import (
+	"sync"
+)
+
+const (
+	StatusRunning = "running"
+	StatusDone    = "done"
+	StatusFailed  = "failed"
+	StatusKilled  = "killed"
+)
+
+// Thread is a handle of forked thread.
+type Thread struct {
+	ID int
+
+	mu     sync.Mutex
+	status string
+	err    error
+	stop   func()
+	killed bool
+	done   chan struct{}
+}
+
+func NewThread(id int) *Thread {
+	return &Thread{
+		ID:     id,
+		status: StatusRunning,
+		done:   make(chan struct{}),
+	}
+}
+
+// SetStop sets function which is called to kill the thread. If thread was
+// killed before, stop is called immediately.
+func (t *Thread) SetStop(stop func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stop = stop
+	if t.killed {
+		stop()
+	}
+}
+
+// Kill stops the thread.
+func (t *Thread) Kill() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.killed || t.status != StatusRunning {
+		return
+	}
+	t.killed = true
+	if t.stop != nil {
+		t.stop()
+	}
+}
+
+// Finish marks thread as finished with given script error.
+func (t *Thread) Finish(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch {
+	case err != nil:
+		t.status = StatusFailed
+	case t.killed:
+		t.status = StatusKilled
+	default:
+		t.status = StatusDone
+	}
+	t.err = err
+	close(t.done)
+}
+
+// Status returns current status of the thread and its script error.
+func (t *Thread) Status() (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.status, t.err
+}
+
+// Done returns channel which is closed when thread finishes.
+func (t *Thread) Done() <-chan struct{} {
+	return t.done
+}
@@ -0,0 +1,53 @@
+package runtime
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestThreadKillBeforeStop(t *testing.T) {
+	th := NewThread(0)
+	th.Kill()
+
+	var stopped bool
+	th.SetStop(func() { stopped = true })
+	if !stopped {
+		t.Errorf("stop is not called for thread killed before it is set")
+	}
+	th.Finish(nil)
+	if s, err := th.Status(); s != StatusKilled || err != nil {
+		t.Errorf("Status() = %q, %v; want %q, nil", s, err, StatusKilled)
+	}
+}
+
+func TestThreadFinish(t *testing.T) {
+	for _, test := range []struct {
+		err    error
+		status string
+	}{
+		{nil, StatusDone},
+		{errors.New("boom"), StatusFailed},
+	} {
+		th := NewThread(0)
+		var stops int
+		th.SetStop(func() { stops++ })
+		if s, _ := th.Status(); s != StatusRunning {
+			t.Errorf("Status() = %q before finish; want %q", s, StatusRunning)
+		}
+
+		th.Finish(test.err)
+		select {
+		case <-th.Done():
+		default:
+			t.Errorf("Done() is not closed after finish")
+		}
+		// Killing finished thread does nothing.
+		th.Kill()
+		if stops != 0 {
+			t.Errorf("stop is called for finished thread")
+		}
+		if s, err := th.Status(); s != test.status || err != test.err {
+			t.Errorf("Status() = %q, %v; want %q, %v", s, err, test.status, test.err)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// Package shared brings lua module for key-value storage shared between
+// threads.
+package shared
+
+import (
+	"time"
+
+	"github.com/gobwas/gws/lua/util"
+	"github.com/yuin/gopher-lua"
+)
+
+// Mod is a "shared" lua module. Values could be nil, booleans, numbers,
+// strings and tables of them; tables are copied on set and get. Optional ttl
+// arguments are in milliseconds.
+type Mod struct {
+	store *Store
+}
+
+func New(s *Store) *Mod {
+	return &Mod{s}
+}
+
+func (m *Mod) Exports() lua.LGFunction {
+	return func(L *lua.LState) int {
+		mod := L.NewTable()
+
+		// get(key) returns value or nil.
+		mod.RawSetString("get", L.NewClosure(func(L *lua.LState) int {
+			v, _ := m.store.Get(L.CheckString(1))
+			L.Push(util.FromGo(L, v))
+			return 1
+		}))
+
+		// set(key, value[, ttl]) returns error.
+		mod.RawSetString("set", L.NewClosure(func(L *lua.LState) int {
+			key := L.CheckString(1)
+			value, err := util.ToGo(L.Get(2))
+			if err != nil {
+				L.Push(lua.LString(err.Error()))
+				return 1
+			}
+			m.store.Set(key, value, ttl(L, 3))
+			return 0
+		}))
+
+		// incr(key[, delta][, ttl]) returns new value and error.
+		mod.RawSetString("incr", L.NewClosure(func(L *lua.LState) int {
+			key := L.CheckString(1)
+			delta := float64(L.OptNumber(2, 1))
+			n, err := m.store.Incr(key, delta, ttl(L, 3))
+			if err != nil {
+				L.Push(lua.LNil)
+				L.Push(lua.LString(err.Error()))
+				return 2
+			}
+			L.Push(lua.LNumber(n))
+			return 1
+		}))
+
+		// cas(key, old, new[, ttl]) returns true if value was replaced and
+		// error.
+		mod.RawSetString("cas", L.NewClosure(func(L *lua.LState) int {
+			key := L.CheckString(1)
+			old, err := util.ToGo(L.Get(2))
+			if err != nil {
+				L.Push(lua.LFalse)
+				L.Push(lua.LString(err.Error()))
+				return 2
+			}
+			value, err := util.ToGo(L.Get(3))
+			if err != nil {
+				L.Push(lua.LFalse)
+				L.Push(lua.LString(err.Error()))
+				return 2
+			}
+			L.Push(lua.LBool(m.store.CAS(key, old, value, ttl(L, 4))))
+			return 1
+		}))
+
+		// del(key) returns true if key existed.
+		mod.RawSetString("del", L.NewClosure(func(L *lua.LState) int {
+			L.Push(lua.LBool(m.store.Del(L.CheckString(1))))
+			return 1
+		}))
+
+		L.Push(mod)
+		return 1
+	}
+}
+
+func ttl(L *lua.LState, n int) time.Duration {
+	ms := float64(L.OptNumber(n, 0))
+	return time.Duration(ms * float64(time.Millisecond))
+}
@@ -0,0 +1,138 @@
+package shared
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gobwas/gws/lua/util"
+)
+
+// Store is a key-value storage which is safe to be shared between threads.
+// Values are expected to be obtained from util.ToGo(). Expired items are
+// removed lazily.
+type Store struct {
+	mu    sync.Mutex
+	items map[string]item
+	now   func() time.Time
+}
+
+type item struct {
+	value   interface{}
+	expires time.Time
+}
+
+func NewStore() *Store {
+	return &Store{
+		items: make(map[string]item),
+		now:   time.Now,
+	}
+}
+
+// Get returns value and true if key exists and is not expired.
+func (s *Store) Get(key string) (interface{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	it, ok := s.get(key)
+	return it.value, ok
+}
+
+// Set sets value of the key. Zero ttl means that key never expires.
+func (s *Store) Set(key string, value interface{}, ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.set(key, value, ttl)
+}
+
+// Incr adds delta to the number stored at key and returns the result. Absent
+// key is treated as zero and gets given ttl.
+func (s *Store) Incr(key string, delta float64, ttl time.Duration) (float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	it, ok := s.get(key)
+	if !ok {
+		s.set(key, delta, ttl)
+		return delta, nil
+	}
+	n, isNum := it.value.(float64)
+	if !isNum {
+		return 0, fmt.Errorf("value of %q is not a number", key)
+	}
+	it.value = n + delta
+	s.items[key] = it
+	return n + delta, nil
+}
+
+// CAS sets value of the key to new if its current value is equal to old. Nil
+// old means that key must be absent. It returns true if value was set.
+func (s *Store) CAS(key string, old, new interface{}, ttl time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	it, ok := s.get(key)
+	switch {
+	case !ok && old != nil:
+		return false
+	case ok && !equal(it.value, old):
+		return false
+	}
+	s.set(key, new, ttl)
+	return true
+}
+
+// Del removes the key and reports whether it existed.
+func (s *Store) Del(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.get(key)
+	delete(s.items, key)
+	return ok
+}
+
+func (s *Store) get(key string) (item, bool) {
+	it, ok := s.items[key]
+	if ok && !it.expires.IsZero() && !s.now().Before(it.expires) {
+		delete(s.items, key)
+		return item{}, false
+	}
+	return it, ok
+}
+
+func (s *Store) set(key string, value interface{}, ttl time.Duration) {
+	if value == nil {
+		delete(s.items, key)
+		return
+	}
+	it := item{value: value}
+	if ttl > 0 {
+		it.expires = s.now().Add(ttl)
+	}
+	s.items[key] = it
+}
+
+// equal compares values obtained from util.ToGo(). Tables are compared
+// regardless of the order of their pairs.
+func equal(a, b interface{}) bool {
+	ta, ok1 := a.(util.Table)
+	tb, ok2 := b.(util.Table)
+	if !ok1 || !ok2 {
+		return a == b
+	}
+	if len(ta) != len(tb) {
+		return false
+	}
+	for _, pa := range ta {
+		var found bool
+		for _, pb := range tb {
+			if equal(pa.Key, pb.Key) {
+				found = equal(pa.Value, pb.Value)
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,51 @@
+package shared
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gobwas/gws/lua/util"
+)
+
+func TestStore(t *testing.T) {
+	now := time.Unix(0, 0)
+	s := NewStore()
+	s.now = func() time.Time { return now }
+
+	if n, err := s.Incr("n", 2, 0); n != 2 || err != nil {
+		t.Errorf("Incr() = %v, %v; want 2, nil", n, err)
+	}
+	if n, err := s.Incr("n", 1, 0); n != 3 || err != nil {
+		t.Errorf("Incr() = %v, %v; want 3, nil", n, err)
+	}
+
+	s.Set("s", "str", 0)
+	if _, err := s.Incr("s", 1, 0); err == nil {
+		t.Errorf("Incr() on string = nil error; want error")
+	}
+
+	table := util.Table{{Key: "a", Value: 1.0}, {Key: "b", Value: "x"}}
+	reordered := util.Table{{Key: "b", Value: "x"}, {Key: "a", Value: 1.0}}
+	if !s.CAS("t", nil, table, 0) {
+		t.Errorf("CAS() on absent key = false; want true")
+	}
+	if s.CAS("t", nil, "other", 0) {
+		t.Errorf("CAS() with nil old on existing key = true; want false")
+	}
+	if !s.CAS("t", reordered, "next", 0) {
+		t.Errorf("CAS() with equal table = false; want true")
+	}
+
+	s.Set("ttl", true, time.Second)
+	if _, ok := s.Get("ttl"); !ok {
+		t.Errorf("Get() before expiration = false; want true")
+	}
+	now = now.Add(time.Second)
+	if _, ok := s.Get("ttl"); ok {
+		t.Errorf("Get() after expiration = true; want false")
+	}
+
+	if !s.Del("t") || s.Del("t") {
+		t.Errorf("Del() twice = unexpected results")
+	}
+}
@@ -0,0 +1,125 @@
+package test
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Case is a result of a finished test case.
+type Case struct {
+	Name     string
+	Thread   string
+	Duration time.Duration
+	Failure  string
+}
+
+func (c Case) Passed() bool {
+	return c.Failure == ""
+}
+
+// Results collects test cases results. It is safe to share Results between
+// threads.
+type Results struct {
+	mu    sync.Mutex
+	cases []Case
+}
+
+func NewResults() *Results {
+	return &Results{}
+}
+
+func (r *Results) Add(c Case) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cases = append(r.cases, c)
+}
+
+func (r *Results) Cases() []Case {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Case(nil), r.cases...)
+}
+
+// Failed returns number of failed cases.
+func (r *Results) Failed() (n int) {
+	for _, c := range r.Cases() {
+		if !c.Passed() {
+			n++
+		}
+	}
+	return
+}
+
+// WriteSummary writes failed cases and total counters in human readable form.
+func (r *Results) WriteSummary(w io.Writer) {
+	cases := r.Cases()
+	var failed int
+	for _, c := range cases {
+		if !c.Passed() {
+			failed++
+			fmt.Fprintf(w, "FAIL %s (%s): %s\n", c.Name, c.Thread, c.Failure)
+		}
+	}
+	fmt.Fprintf(w, "tests: %d passed, %d failed, %d total\n", len(cases)-failed, failed, len(cases))
+}
+
+type junitSuite struct {
+	XMLName  xml.Name    `xml:"testsuite"`
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes results in JUnit XML format as a single test suite with
+// given name.
+func (r *Results) WriteJUnit(w io.Writer, name string) error {
+	suite := junitSuite{Name: name}
+	var total time.Duration
+	for _, c := range r.Cases() {
+		jc := junitCase{
+			Name:      c.Name,
+			ClassName: name + "." + c.Thread,
+			Time:      seconds(c.Duration),
+		}
+		if !c.Passed() {
+			suite.Failures++
+			jc.Failure = &junitFailure{Message: c.Failure, Text: c.Failure}
+		}
+		total += c.Duration
+		suite.Cases = append(suite.Cases, jc)
+	}
+	suite.Tests = len(suite.Cases)
+	suite.Time = seconds(total)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suite); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
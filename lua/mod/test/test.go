@@ -0,0 +1,320 @@
+// Package test brings lua module for writing test cases with assertions.
+package test
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gobwas/gws/ev"
+	"github.com/yuin/gopher-lua"
+)
+
+// defaultTimeout is a time given to asynchronous test case to call done().
+const defaultTimeout = 5 * time.Second
+
+// Mod is a "test" lua module.
+//
+// Cases are run one by one in order of registration. Case function that
+// accepts arguments is treated as asynchronous and receives done([err])
+// callback which must be called to finish the case.
+//
+// Failed assertion raises an error when called from the case function
+// itself. When called later from some callback of asynchronous case it
+// finishes the case as failed instead. Case function is run with its own
+// environment, which functions created inside of it inherit; this is how
+// assertion called from callback finds the case it belongs to, even when
+// other case is running. Assertions called from functions created outside of
+// case functions belong to the running case.
+type Mod struct {
+	loop    *ev.Loop
+	results *Results
+	thread  string
+
+	queue     []*testCase
+	current   *testCase
+	scheduled bool
+	envs      map[*lua.LTable]*testCase
+}
+
+type testCase struct {
+	name     string
+	fn       *lua.LFunction
+	timeout  time.Duration
+	start    time.Time
+	timer    *ev.Timer
+	inBody   bool
+	finished bool
+}
+
+func New(loop *ev.Loop, results *Results, thread string) *Mod {
+	return &Mod{
+		loop:    loop,
+		results: results,
+		thread:  thread,
+		envs:    make(map[*lua.LTable]*testCase),
+	}
+}
+
+func (m *Mod) Exports() lua.LGFunction {
+	return func(L *lua.LState) int {
+		mod := L.NewTable()
+
+		// case(name, fn[, opts])
+		// opts is a table with optional "timeout" field in milliseconds.
+		mod.RawSetString("case", L.NewClosure(func(L *lua.LState) int {
+			c := &testCase{
+				name:    L.CheckString(1),
+				fn:      L.CheckFunction(2),
+				timeout: defaultTimeout,
+			}
+			if opts := L.ToTable(3); opts != nil {
+				if ms, ok := opts.RawGetString("timeout").(lua.LNumber); ok {
+					c.timeout = time.Duration(float64(ms) * float64(time.Millisecond))
+				}
+			}
+			m.queue = append(m.queue, c)
+			if !m.scheduled {
+				m.scheduled = true
+				m.loop.Call(func() { m.next(L) })
+			}
+			return 0
+		}))
+
+		assert := L.NewTable()
+
+		// eq(actual, expected[, message]) compares values; tables are compared
+		// deeply.
+		assert.RawSetString("eq", L.NewClosure(func(L *lua.LState) int {
+			actual, expected := L.Get(1), L.Get(2)
+			if !deepEqual(L, actual, expected, nil) {
+				m.fail(L, L.OptString(3, ""), fmt.Sprintf("expected %s, got %s", repr(expected, nil), repr(actual, nil)))
+			}
+			return 0
+		}))
+
+		// match(str, pattern[, message]) checks that str matches lua pattern.
+		assert.RawSetString("match", L.NewClosure(func(L *lua.LState) int {
+			str, pattern := L.CheckString(1), L.CheckString(2)
+			L.Push(L.GetField(L.GetGlobal("string"), "find"))
+			L.Push(lua.LString(str))
+			L.Push(lua.LString(pattern))
+			L.Call(2, 1)
+			found := L.Get(-1) != lua.LNil
+			L.Pop(1)
+			if !found {
+				m.fail(L, L.OptString(3, ""), fmt.Sprintf("%q does not match %q", str, pattern))
+			}
+			return 0
+		}))
+
+		// ok(value[, message]) checks that value is neither nil nor false.
+		assert.RawSetString("ok", L.NewClosure(func(L *lua.LState) int {
+			if !lua.LVAsBool(L.Get(1)) {
+				m.fail(L, L.OptString(2, ""), fmt.Sprintf("expected truthy value, got %s", repr(L.Get(1), nil)))
+			}
+			return 0
+		}))
+
+		mod.RawSetString("assert", assert)
+
+		L.Push(mod)
+		return 1
+	}
+}
+
+// fail raises an error or finishes asynchronous case of the assertion as
+// failed.
+func (m *Mod) fail(L *lua.LState, message, reason string) {
+	if message != "" {
+		reason = message + ": " + reason
+	}
+	c := m.caseOf(L)
+	if c == nil || c.inBody {
+		L.RaiseError("%s", reason)
+		return
+	}
+	// Failures after the case is finished are ignored.
+	m.finish(L, c, L.Where(1)+" "+reason)
+}
+
+// caseOf returns case which function created the function calling the
+// assertion, or the running case if there is no such.
+func (m *Mod) caseOf(L *lua.LState) *testCase {
+	dbg, ok := L.GetStack(1)
+	if !ok {
+		return m.current
+	}
+	fn, err := L.GetInfo("f", dbg, lua.LNil)
+	if err != nil {
+		return m.current
+	}
+	if f, ok := fn.(*lua.LFunction); ok && f.Env != nil {
+		if c, ok := m.envs[f.Env]; ok {
+			return c
+		}
+	}
+	return m.current
+}
+
+func (m *Mod) next(L *lua.LState) {
+	if len(m.queue) == 0 {
+		m.current = nil
+		m.scheduled = false
+		return
+	}
+	c := m.queue[0]
+	m.queue = m.queue[1:]
+	m.current = c
+	m.run(L, c)
+}
+
+func (m *Mod) run(L *lua.LState, c *testCase) {
+	c.start = time.Now()
+	if !c.fn.IsG {
+		c.fn.Env = m.caseEnv(L, c)
+	}
+
+	var args []lua.LValue
+	async := c.fn.Proto != nil && c.fn.Proto.NumParameters > 0
+	if async {
+		args = append(args, L.NewClosure(func(L *lua.LState) int {
+			var failure string
+			if err := L.Get(1); err != lua.LNil {
+				failure = err.String()
+			}
+			m.finish(L, c, failure)
+			return 0
+		}))
+		c.timer = m.loop.Timeout(c.timeout, false, func() {
+			m.finish(L, c, fmt.Sprintf("timeout after %s", c.timeout))
+		})
+	}
+
+	c.inBody = true
+	err := L.CallByParam(lua.P{
+		Fn:      c.fn,
+		NRet:    0,
+		Protect: true,
+	}, args...)
+	c.inBody = false
+
+	switch {
+	case err != nil:
+		m.finish(L, c, errorMessage(err))
+	case !async:
+		m.finish(L, c, "")
+	}
+}
+
+// caseEnv returns environment of the case function, which reads and writes
+// globals of the original environment.
+func (m *Mod) caseEnv(L *lua.LState, c *testCase) *lua.LTable {
+	meta := L.NewTable()
+	meta.RawSetString("__index", c.fn.Env)
+	meta.RawSetString("__newindex", c.fn.Env)
+	env := L.NewTable()
+	L.SetMetatable(env, meta)
+	m.envs[env] = c
+	return env
+}
+
+func (m *Mod) finish(L *lua.LState, c *testCase, failure string) {
+	if c.finished {
+		return
+	}
+	c.finished = true
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+
+	result := Case{
+		Name:     c.name,
+		Thread:   m.thread,
+		Duration: time.Since(c.start),
+		Failure:  failure,
+	}
+	m.results.Add(result)
+
+	var line string
+	if result.Passed() {
+		line = fmt.Sprintf("ok   %s (%s)", c.name, result.Duration)
+	} else {
+		line = fmt.Sprintf("FAIL %s (%s): %s", c.name, result.Duration, failure)
+	}
+	L.CallByParam(lua.P{Fn: L.GetGlobal("print"), NRet: 0, Protect: true}, lua.LString(line))
+
+	// Run next case after current call stack is unwound.
+	m.loop.Call(func() { m.next(L) })
+}
+
+func errorMessage(err error) string {
+	if apiErr, ok := err.(*lua.ApiError); ok && apiErr.Object != nil {
+		return apiErr.Object.String()
+	}
+	return err.Error()
+}
+
+// repr returns string representation of the value. Tables which are being
+// represented are given by path, to not to recurse into cycles.
+func repr(v lua.LValue, path map[*lua.LTable]bool) string {
+	if s, ok := v.(lua.LString); ok {
+		return fmt.Sprintf("%q", string(s))
+	}
+	if t, ok := v.(*lua.LTable); ok {
+		if path[t] {
+			return "<cycle>"
+		}
+		if path == nil {
+			path = make(map[*lua.LTable]bool)
+		}
+		path[t] = true
+		defer delete(path, t)
+
+		str := "{"
+		var i int
+		t.ForEach(func(k, v lua.LValue) {
+			if i > 0 {
+				str += ", "
+			}
+			i++
+			str += "[" + repr(k, path) + "] = " + repr(v, path)
+		})
+		return str + "}"
+	}
+	return v.String()
+}
+
+// deepEqual compares values, recursing into tables. Pairs of tables which
+// are being compared are given by visited; they are considered equal when
+// met again, so cyclic tables are compared by their structure.
+func deepEqual(L *lua.LState, a, b lua.LValue, visited map[[2]*lua.LTable]bool) bool {
+	ta, ok1 := a.(*lua.LTable)
+	tb, ok2 := b.(*lua.LTable)
+	if !ok1 || !ok2 {
+		return L.Equal(a, b)
+	}
+	if ta == tb {
+		return true
+	}
+	pair := [2]*lua.LTable{ta, tb}
+	if visited[pair] {
+		return true
+	}
+	if visited == nil {
+		visited = make(map[[2]*lua.LTable]bool)
+	}
+	visited[pair] = true
+
+	equal := true
+	ta.ForEach(func(k, v lua.LValue) {
+		if equal && !deepEqual(L, v, tb.RawGet(k), visited) {
+			equal = false
+		}
+	})
+	tb.ForEach(func(k, v lua.LValue) {
+		if equal && ta.RawGet(k) == lua.LNil {
+			equal = false
+		}
+	})
+	return equal
+}
@@ -0,0 +1,78 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gobwas/gws/ev"
+	"github.com/yuin/gopher-lua"
+)
+
+func TestCases(t *testing.T) {
+	loop := ev.NewLoop()
+	loop.SetClock(ev.NewVirtualClock(time.Unix(0, 0)))
+	results := NewResults()
+
+	L := lua.NewState()
+	defer L.Close()
+	L.PreloadModule("test", New(loop, results, "master").Exports())
+	// later(ms, fn) calls fn after ms milliseconds.
+	L.SetGlobal("later", L.NewFunction(func(L *lua.LState) int {
+		ms, fn := L.CheckNumber(1), L.CheckFunction(2)
+		loop.Timeout(time.Duration(ms)*time.Millisecond, false, func() {
+			L.CallByParam(lua.P{Fn: fn, Protect: true})
+		})
+		return 0
+	}))
+
+	err := L.DoString(`
+		local test = require("test")
+
+		test.case("cycle", function()
+			local a, b = {}, {}
+			a.self, b.self = a, b
+			test.assert.eq(a, b)
+			local ok, err = pcall(test.assert.eq, a, { self = {} })
+			assert(not ok and string.find(err, "<cycle>"), err)
+		end)
+
+		test.case("late", function(done)
+			later(10, function()
+				test.assert.ok(false, "late failure")
+			end)
+			done()
+		end)
+
+		test.case("running", function(done)
+			later(20, done)
+		end)
+
+		test.case("async", function(done)
+			later(10, function()
+				test.assert.eq(1, 2)
+				done()
+			end)
+		end)
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loop.Run()
+	<-loop.Done()
+
+	want := map[string]bool{
+		"cycle":   true,
+		"late":    true,
+		"running": true,
+		"async":   false,
+	}
+	cases := results.Cases()
+	if len(cases) != len(want) {
+		t.Fatalf("got %d cases; want %d", len(cases), len(want))
+	}
+	for _, c := range cases {
+		if c.Passed() != want[c.Name] {
+			t.Errorf("case %q passed is %v (%s); want %v", c.Name, c.Passed(), c.Failure, want[c.Name])
+		}
+	}
+}
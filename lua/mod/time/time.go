@@ -2,6 +2,7 @@ package time
 
 import (
 	"github.com/gobwas/gws/ev"
+	luamod "github.com/gobwas/gws/lua/mod"
 	"github.com/yuin/gopher-lua"
 	"time"
 )
@@ -17,14 +18,16 @@ const (
 type Mod struct {
 	initTime       time.Time
 	loop           *ev.Loop
+	co             *luamod.Coroutines
 	timers         map[uint32]*ev.Timer
 	timeoutCounter uint32
 }
 
-func New(loop *ev.Loop) *Mod {
+func New(loop *ev.Loop, co *luamod.Coroutines) *Mod {
 	return &Mod{
-		initTime: time.Now(),
+		initTime: loop.Now(),
 		loop:     loop,
+		co:       co,
 		timers:   make(map[uint32]*ev.Timer),
 	}
 }
@@ -38,7 +41,7 @@ func (m *Mod) Exports() lua.LGFunction {
 		L.SetField(mod, "s", lua.LNumber(durationSeconds))
 
 		mod.RawSetString("now", L.NewClosure(func(L *lua.LState) int {
-			now := inPrecision(time.Since(m.initTime), durationKind(L.ToNumber(1)))
+			now := inPrecision(m.loop.Now().Sub(m.initTime), durationKind(L.ToNumber(1)))
 			L.Push(lua.LNumber(now))
 			return 1
 		}))
@@ -50,6 +53,15 @@ func (m *Mod) Exports() lua.LGFunction {
 				L.Push(lua.LString(err.Error()))
 				return 1
 			}
+			if m.co.CanYield(L) {
+				return m.co.Yield(L, func(resume func(...lua.LValue)) {
+					m.loop.Timeout(duration, false, func() { resume() })
+				})
+			}
+			if vc, ok := m.loop.Clock().(*ev.VirtualClock); ok {
+				vc.Advance(duration)
+				return 0
+			}
 			time.Sleep(duration)
 			return 0
 		}))
@@ -60,11 +72,7 @@ func (m *Mod) Exports() lua.LGFunction {
 
 			m.timeoutCounter++
 			timeout := m.loop.Timeout(time.Duration(tm)*time.Millisecond, false, func() {
-				L.CallByParam(lua.P{
-					Fn:      cb,
-					NRet:    0,
-					Protect: false,
-				})
+				luamod.Call(L, cb)
 			})
 			m.timers[m.timeoutCounter] = timeout
 
@@ -79,11 +87,7 @@ func (m *Mod) Exports() lua.LGFunction {
 
 			m.timeoutCounter++
 			timeout := m.loop.Timeout(time.Duration(tm)*time.Millisecond, true, func() {
-				L.CallByParam(lua.P{
-					Fn:      cb,
-					NRet:    0,
-					Protect: false,
-				})
+				luamod.Call(L, cb)
 			})
 			m.timers[m.timeoutCounter] = timeout
 
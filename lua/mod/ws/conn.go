@@ -5,24 +5,37 @@ import (
 	evws "github.com/gobwas/gws/ev/ws"
 	"github.com/gobwas/gws/lua/mod"
 	"github.com/gobwas/gws/ws"
+	"github.com/gorilla/websocket"
 	"github.com/yuin/gopher-lua"
 )
 
 type Conn struct {
 	conn    *ws.Connection
 	loop    *ev.Loop
+	co      *mod.Coroutines
 	emitter *mod.Emitter
 
 	receive  *evws.Receive
 	listener []ln
 }
 
-func NewConn(c *ws.Connection, l *ev.Loop) *Conn {
-	return &Conn{
+func NewConn(c *ws.Connection, l *ev.Loop, co *mod.Coroutines) *Conn {
+	conn := &Conn{
 		emitter: mod.NewEmitter(),
 		conn:    c,
 		loop:    l,
+		co:      co,
 	}
+	c.OnPing(func(data []byte) {
+		conn.Emit("ping", string(data))
+	})
+	c.OnPong(func(data []byte) {
+		conn.Emit("pong", string(data))
+	})
+	c.OnClose(func(code int, reason string) {
+		conn.Emit("close", code, reason)
+	})
+	return conn
 }
 
 func (c *Conn) Emit(name string, args ...interface{}) {
@@ -34,11 +47,32 @@ func (c *Conn) Emit(name string, args ...interface{}) {
 func (c *Conn) ToTable(L *lua.LState) *lua.LTable {
 	table := L.NewTable()
 
+	// send(data[, opts][, cb])
+	// opts is a table with optional "binary" boolean field.
 	table.RawSetString("send", L.NewClosure(func(L *lua.LState) int {
 		str := L.ToString(1)
-		msg := ws.MessageRaw{ws.TextMessage, []byte(str)}
+		msg := ws.MessageRaw{Kind: ws.TextMessage, Data: []byte(str)}
+
+		cbIndex := 2
+		if opts, ok := L.Get(2).(*lua.LTable); ok {
+			if lua.LVAsBool(opts.RawGetString("binary")) {
+				msg.Kind = ws.BinaryMessage
+			}
+			cbIndex = 3
+		}
 
-		cb := L.ToFunction(2)
+		cb := L.ToFunction(cbIndex)
+		if cb == nil && c.co.CanYield(L) {
+			return c.co.Yield(L, func(resume func(...lua.LValue)) {
+				c.loop.Request(100, evws.Send{Conn: c.conn, Message: msg}, func(err error, _ interface{}) {
+					if err != nil {
+						resume(lua.LString(err.Error()))
+					} else {
+						resume()
+					}
+				})
+			})
+		}
 		if cb == nil { // if there is no callback - call is synchronous
 			if err := c.conn.Send(msg); err != nil {
 				L.Push(lua.LString(err.Error()))
@@ -47,42 +81,41 @@ func (c *Conn) ToTable(L *lua.LState) *lua.LTable {
 			return 0
 		}
 
-		c.loop.Request(100, evws.Send{c.conn, msg}, func(err error, _ interface{}) {
+		c.loop.Request(100, evws.Send{Conn: c.conn, Message: msg}, func(err error, _ interface{}) {
 			var e lua.LValue
 			if err != nil {
 				e = lua.LString(err.Error())
 			} else {
 				e = lua.LNil
 			}
-			L.CallByParam(lua.P{
-				Fn:      cb,
-				NRet:    0,
-				Protect: false,
-			}, e)
+			mod.Call(L, cb, e)
 		})
 		return 0
 	}))
 
+	table.RawSetString("ping", L.NewClosure(func(L *lua.LState) int {
+		if err := c.conn.Ping([]byte(L.ToString(1))); err != nil {
+			L.Push(lua.LString(err.Error()))
+			return 1
+		}
+		return 0
+	}))
+
+	// listen(cb)
+	// cb is called with error, message data and message table.
 	table.RawSetString("listen", L.NewClosure(func(L *lua.LState) int {
 		cb := L.ToFunction(1)
 		c.listener = append(c.listener, ln{cb, L})
 
 		if c.receive == nil {
 			c.receive = evws.NewReceive(c.conn)
-			c.loop.Request(100, c.receive, func(err error, msg interface{}) {
+			c.loop.Request(100, c.receive, func(err error, data interface{}) {
 				for _, ln := range c.listener {
 					if err != nil {
-						ln.state.CallByParam(lua.P{
-							Fn:      cb,
-							NRet:    0,
-							Protect: false,
-						}, lua.LString(err.Error()), lua.LNil)
+						mod.Call(ln.state, ln.cb, lua.LString(err.Error()), lua.LNil, lua.LNil)
 					} else {
-						ln.state.CallByParam(lua.P{
-							Fn:      cb,
-							NRet:    0,
-							Protect: false,
-						}, lua.LNil, lua.LString(msg.(string)))
+						msg := data.(ws.MessageRaw)
+						mod.Call(ln.state, ln.cb, lua.LNil, lua.LString(msg.Data), MessageToTable(ln.state, msg))
 					}
 				}
 			})
@@ -91,12 +124,27 @@ func (c *Conn) ToTable(L *lua.LState) *lua.LTable {
 		return 0
 	}))
 
+	// receive() returns message data, error and message table.
+	// It yields inside of coroutine instead of blocking.
 	table.RawSetString("receive", L.NewClosure(func(L *lua.LState) int {
 		if c.receive != nil {
 			L.Push(lua.LString("could not receive synchronous: there are already registered listeners"))
 			return 1
 		}
 
+		if c.co.CanYield(L) {
+			return c.co.Yield(L, func(resume func(...lua.LValue)) {
+				c.loop.Request(100, evws.ReceiveOnce{Conn: c.conn}, func(err error, data interface{}) {
+					if err != nil {
+						resume(lua.LNil, lua.LString(err.Error()))
+						return
+					}
+					msg := data.(ws.MessageRaw)
+					resume(lua.LString(msg.Data), lua.LNil, MessageToTable(L, msg))
+				})
+			})
+		}
+
 		msg, err := c.conn.Receive()
 		if err != nil {
 			L.Push(lua.LNil)
@@ -105,17 +153,21 @@ func (c *Conn) ToTable(L *lua.LState) *lua.LTable {
 		} else {
 			L.Push(lua.LString(msg.Data))
 			L.Push(lua.LNil)
-			return 2
+			L.Push(MessageToTable(L, msg))
+			return 3
 		}
 	}))
 
+	// close([code][, reason])
 	table.RawSetString("close", L.NewClosure(func(L *lua.LState) int {
-		if err := c.conn.Close(); err != nil {
+		code := L.OptInt(1, websocket.CloseNormalClosure)
+		reason := L.OptString(2, "")
+		if err := c.conn.CloseWithCode(code, reason); err != nil {
 			L.Push(lua.LString(err.Error()))
 			return 1
 		}
 
-		c.Emit("close")
+		c.Emit("close", code, reason)
 		return 0
 	}))
 
@@ -125,6 +177,34 @@ func (c *Conn) ToTable(L *lua.LState) *lua.LTable {
 	return table
 }
 
+// MessageToTable converts message to lua table with "kind", "data" and
+// "binary" fields.
+func MessageToTable(L *lua.LState, msg ws.MessageRaw) *lua.LTable {
+	table := L.NewTable()
+	table.RawSetString("kind", lua.LString(KindName(msg.Kind)))
+	table.RawSetString("data", lua.LString(msg.Data))
+	table.RawSetString("binary", lua.LBool(msg.Kind == ws.BinaryMessage))
+	return table
+}
+
+// KindName returns short name of message kind used in lua.
+func KindName(k ws.Kind) string {
+	switch k {
+	case ws.TextMessage:
+		return "text"
+	case ws.BinaryMessage:
+		return "binary"
+	case ws.CloseMessage:
+		return "close"
+	case ws.PingMessage:
+		return "ping"
+	case ws.PongMessage:
+		return "pong"
+	default:
+		return "unknown"
+	}
+}
+
 type ln struct {
 	cb    *lua.LFunction
 	state *lua.LState
@@ -0,0 +1,148 @@
+package ws
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gobwas/gws/ev"
+	evws "github.com/gobwas/gws/ev/ws"
+	"github.com/gobwas/gws/lua/mod"
+	"github.com/gobwas/gws/ws"
+	"github.com/gorilla/websocket"
+	"github.com/yuin/gopher-lua"
+)
+
+// runConn starts websocket server with given handler and runs script which
+// connects to it. Script calls log() to record events, which are returned.
+func runConn(t *testing.T, handle func(*websocket.Conn), code string) []string {
+	upgrade := ws.GetUpgrader(ws.UpgradeConfig{Origin: "*"})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrade(w, r)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		handle(conn)
+	}))
+	defer srv.Close()
+
+	loop := ev.NewLoop()
+	loop.Register(evws.NewClientHandler(), 100)
+
+	L := lua.NewState()
+	defer L.Close()
+	mod.SetErrorHandler(L, func(_ *lua.LState, err error) {
+		t.Errorf("lua error: %s", err)
+	})
+	L.PreloadModule("ws", New(loop, mod.NewCoroutines(loop)).Exports())
+	L.SetGlobal("url", lua.LString("ws"+strings.TrimPrefix(srv.URL, "http")))
+	var events []string
+	L.SetGlobal("log", L.NewFunction(func(L *lua.LState) int {
+		var args []string
+		for i := 1; i <= L.GetTop(); i++ {
+			args = append(args, L.Get(i).String())
+		}
+		events = append(events, strings.Join(args, " "))
+		return 0
+	}))
+
+	if err := L.DoString(code); err != nil {
+		t.Fatal(err)
+	}
+	loop.Run()
+	select {
+	case <-loop.Done():
+	case <-time.After(5 * time.Second):
+		loop.Shutdown()
+		t.Fatalf("script is not finished; events: %q", events)
+	}
+	return events
+}
+
+func TestConnEvents(t *testing.T) {
+	received := make(chan string, 10)
+	events := runConn(t, func(conn *websocket.Conn) {
+		for {
+			// Pings of client are answered with pongs while reading.
+			msg, err := ws.ReadFromConn(conn)
+			if err != nil {
+				received <- err.Error()
+				return
+			}
+			received <- fmt.Sprintf("%s %s", KindName(msg.Kind), msg.Data)
+			conn.WriteControl(websocket.PingMessage, []byte("server"), time.Now().Add(time.Second))
+		}
+	}, `
+		local ws = require("ws")
+		ws.connect({ url = url }, function(err, conn)
+			assert(err == nil, err)
+			conn.on("ping", function(data)
+				log("ping", data)
+				conn.ping("client")
+			end)
+			conn.on("pong", function(data)
+				log("pong", data)
+				conn.close(4000, "bye")
+			end)
+			conn.on("close", function(code, reason)
+				log("close", code, reason)
+			end)
+			conn.listen(function() end)
+			conn.send("hello", { binary = true }, function(err)
+				assert(err == nil, err)
+			end)
+		end)
+	`)
+
+	want := []string{"ping server", "pong client", "close 4000 bye"}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("got events %q; want %q", events, want)
+	}
+	for _, want := range []string{
+		"binary hello",
+		"websocket: close 4000: bye",
+	} {
+		select {
+		case got := <-received:
+			if got != want {
+				t.Errorf("server received %q; want %q", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("server did not receive %q", want)
+		}
+	}
+}
+
+func TestConnCloseEvent(t *testing.T) {
+	events := runConn(t, func(conn *websocket.Conn) {
+		conn.WriteControl(
+			websocket.CloseMessage,
+			websocket.FormatCloseMessage(4001, "gone"),
+			time.Now().Add(time.Second),
+		)
+		ws.ReadFromConn(conn)
+	}, `
+		local ws = require("ws")
+		ws.connect({ url = url }, function(err, conn)
+			assert(err == nil, err)
+			conn.on("close", function(code, reason)
+				log("close", code, reason)
+			end)
+			conn.listen(function(err)
+				log("listen", err ~= nil)
+				conn.close()
+			end)
+		end)
+	`)
+
+	want := []string{"close 4001 gone", "listen true"}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("got events %q; want %q", events, want)
+	}
+}
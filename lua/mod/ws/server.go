@@ -11,13 +11,15 @@ type Server struct {
 	loop    *ev.Loop
 	emitter *mod.Emitter
 	config  ws.ServerConfig
+	co      *mod.Coroutines
 }
 
-func NewServer(l *ev.Loop, c ws.ServerConfig) *Server {
+func NewServer(l *ev.Loop, c ws.ServerConfig, co *mod.Coroutines) *Server {
 	return &Server{
 		loop:    l,
 		emitter: mod.NewEmitter(),
 		config:  c,
+		co:      co,
 	}
 }
 
@@ -47,12 +49,8 @@ func (s *Server) ToTable(L *lua.LState) *lua.LTable {
 
 			if c, ok := msg.(*ws.Connection); ok {
 				c.InitIOWorkers()
-				conn := NewConn(c, s.loop)
-				L.CallByParam(lua.P{
-					Fn:      cb,
-					NRet:    0,
-					Protect: false,
-				}, conn.ToTable(L))
+				conn := NewConn(c, s.loop, s.co)
+				mod.Call(L, cb, conn.ToTable(L))
 				return
 			}
 
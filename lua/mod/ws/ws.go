@@ -3,6 +3,8 @@ package ws
 import (
 	"github.com/gobwas/gws/ev"
 	evws "github.com/gobwas/gws/ev/ws"
+	luamod "github.com/gobwas/gws/lua/mod"
+	modhttp "github.com/gobwas/gws/lua/mod/http"
 	luautil "github.com/gobwas/gws/lua/util"
 	"github.com/gobwas/gws/ws"
 	"github.com/yuin/gopher-lua"
@@ -11,11 +13,13 @@ import (
 
 type Mod struct {
 	loop *ev.Loop
+	co   *luamod.Coroutines
 }
 
-func New(loop *ev.Loop) *Mod {
+func New(loop *ev.Loop, co *luamod.Coroutines) *Mod {
 	return &Mod{
 		loop: loop,
+		co:   co,
 	}
 }
 
@@ -45,65 +49,32 @@ func (m *Mod) Exports() lua.LGFunction {
 				})
 			}
 
-			server := NewServer(m.loop, cfg)
+			server := NewServer(m.loop, cfg, m.co)
 			L.Push(server.ToTable(L))
 
 			return 1
 		}))
 
+		// connect(opts[, cb])
+		// When cb is omitted inside of coroutine, connect yields and returns
+		// connection and error.
 		mod.RawSetString("connect", L.NewClosure(func(L *lua.LState) int {
 			opts := L.ToTable(1)
 			cb := L.ToFunction(2)
-
-			var uri string
-			if u := opts.RawGetString("url"); u.Type() == lua.LTString {
-				uri = u.String()
-			} else {
-				m.loop.Call(func() {
-					L.CallByParam(lua.P{
-						Fn:      cb,
-						NRet:    0,
-						Protect: false,
-					}, lua.LString("url is expected to be a string in options table"), lua.LNil)
-				})
-				return 0
-			}
-
-			var headers http.Header
-			if h := opts.RawGetString("headers"); h.Type() == lua.LTTable {
-				headers = make(http.Header)
-				h.(*lua.LTable).ForEach(func(k, v lua.LValue) {
-					if k.Type() == lua.LTString && v.Type() == lua.LTString {
-						headers.Set(k.String(), v.String())
-					}
+			if cb == nil {
+				if !m.co.CanYield(L) {
+					L.ArgError(2, "callback expected outside of coroutine")
+				}
+				return m.co.Yield(L, func(resume func(...lua.LValue)) {
+					m.connect(L, opts, func(err lua.LValue, conn lua.LValue) {
+						resume(conn, err)
+					})
 				})
 			}
 
-			// todo use constant for channel id
-			m.loop.Request(100, evws.Connect{uri, headers}, func(err error, data interface{}) {
-				if err != nil {
-					L.CallByParam(lua.P{
-						Fn:      cb,
-						NRet:    0,
-						Protect: false,
-					}, lua.LString(err.Error()), lua.LNil)
-					return
-				}
-
-				if c, ok := data.(*ws.Connection); ok {
-					c.InitIOWorkers()
-					conn := NewConn(c, m.loop)
-					L.CallByParam(lua.P{
-						Fn:      cb,
-						NRet:    0,
-						Protect: false,
-					}, lua.LNil, conn.ToTable(L))
-					return
-				}
-
-				panic("ws: unexpected data in request callback")
+			m.connect(L, opts, func(err lua.LValue, conn lua.LValue) {
+				luamod.Call(L, cb, err, conn)
 			})
-
 			return 0
 		}))
 
@@ -111,3 +82,47 @@ func (m *Mod) Exports() lua.LGFunction {
 		return 1
 	}
 }
+
+// connect calls cb with error and connection table from the loop goroutine.
+func (m *Mod) connect(L *lua.LState, opts *lua.LTable, cb func(err, conn lua.LValue)) {
+	if opts == nil || opts.RawGetString("url").Type() != lua.LTString {
+		m.loop.Call(func() {
+			cb(lua.LString("url is expected to be a string in options table"), lua.LNil)
+		})
+		return
+	}
+	uri := opts.RawGetString("url").String()
+
+	var headers http.Header
+	if h := opts.RawGetString("headers"); h.Type() == lua.LTTable {
+		headers = make(http.Header)
+		h.(*lua.LTable).ForEach(func(k, v lua.LValue) {
+			if k.Type() == lua.LTString && v.Type() == lua.LTString {
+				headers.Set(k.String(), v.String())
+			}
+		})
+	}
+
+	connect := evws.Connect{
+		Url:     uri,
+		Headers: headers,
+		Jar:     modhttp.JarFromValue(opts.RawGetString("jar")),
+	}
+
+	// todo use constant for channel id
+	m.loop.Request(100, connect, func(err error, data interface{}) {
+		if err != nil {
+			cb(lua.LString(err.Error()), lua.LNil)
+			return
+		}
+
+		if c, ok := data.(*ws.Connection); ok {
+			c.InitIOWorkers()
+			conn := NewConn(c, m.loop, m.co)
+			cb(lua.LNil, conn.ToTable(L))
+			return
+		}
+
+		panic("ws: unexpected data in request callback")
+	})
+}
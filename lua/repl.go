@@ -0,0 +1,211 @@
+package lua
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/chzyer/readline"
+	"github.com/gobwas/gws/cli/color"
+	"github.com/gobwas/gws/config"
+	evHTTP "github.com/gobwas/gws/ev/http"
+	evWS "github.com/gobwas/gws/ev/ws"
+	"github.com/gobwas/gws/lua/mod"
+	modCrypto "github.com/gobwas/gws/lua/mod/crypto"
+	modFS "github.com/gobwas/gws/lua/mod/fs"
+	modHTTP "github.com/gobwas/gws/lua/mod/http"
+	modJSON "github.com/gobwas/gws/lua/mod/json"
+	modRand "github.com/gobwas/gws/lua/mod/rand"
+	modRuntime "github.com/gobwas/gws/lua/mod/runtime"
+	modShared "github.com/gobwas/gws/lua/mod/shared"
+	modStat "github.com/gobwas/gws/lua/mod/stat"
+	modTime "github.com/gobwas/gws/lua/mod/time"
+	modWS "github.com/gobwas/gws/lua/mod/ws"
+	"github.com/gobwas/gws/lua/script"
+	"github.com/gobwas/gws/stat"
+	"github.com/yuin/gopher-lua"
+)
+
+var useRepl = flag.Bool("repl", false, "run interactive lua shell (after the script if -path is given)")
+
+const readLineTemp = "/tmp/gws_readline_lua.tmp"
+
+var errInterrupted = errors.New("interrupted; the line is left suspended")
+
+// replModules are required into globals of the shell.
+var replModules = []string{"ws", "time", "stat", "json", "runtime", "http", "shared", "crypto", "rand", "fs"}
+
+// goRepl runs lua shell. Lines are evaluated in coroutines on the event loop,
+// which is running in background, so callbacks fire while user types.
+func goRepl(c config.Config) error {
+	rl, err := readline.NewEx(&readline.Config{
+		Prompt:      color.Green("> "),
+		HistoryFile: readLineTemp,
+	})
+	if err != nil {
+		return err
+	}
+	defer rl.Close()
+
+	args, err := modRuntime.ParseArgs(*scriptArgs, flag.Args())
+	if err != nil {
+		return err
+	}
+	dir := "."
+	if *scriptFile != "" {
+		dir = filepath.Dir(*scriptFile)
+	}
+	fs, err := modFS.New(dir, *fsRoot)
+	if err != nil {
+		return err
+	}
+
+	stats := stat.New()
+
+	s := script.New()
+	defer s.Shutdown()
+	s.HijackOutput(rl.Stdout())
+	s.SetPath(append([]string{dir}, *luaPath...)...)
+	s.SetErrorHandler(func(L *lua.LState, err error) {
+		fmt.Fprintln(rl.Stderr(), color.Red(err.Error()))
+	})
+
+	settings := flagSettings()
+	loop := settings.newLoop()
+	loop.Register(evWS.NewClientHandler(), 100)
+	loop.Register(evWS.NewServerHandler(), 101)
+	loop.Register(evHTTP.NewHandler(), 102)
+
+	co := mod.NewCoroutines(loop)
+	rtime := initRunTime(loop, co, c, args)
+
+	s.Preload("runtime", rtime)
+	s.Preload("stat", modStat.New(stats))
+	s.Preload("shared", modShared.New(modShared.NewStore()))
+	s.Preload("time", modTime.New(loop, co))
+	s.Preload("ws", modWS.New(loop, co))
+	s.Preload("json", modJSON.New())
+	s.Preload("http", modHTTP.New(loop))
+	s.Preload("crypto", modCrypto.New())
+	s.Preload("fs", fs)
+	s.Preload("rand", modRand.New(settings.seed(modRuntime.MasterID)))
+
+	// Keep loop alive until shell is closed.
+	loop.Ref()
+	loop.Run()
+	defer func() {
+		loop.Unref()
+		loop.Stop()
+		<-loop.Done()
+	}()
+
+	// Ctrl+C stops waiting for the line which yields for too long. Terminal
+	// is not in raw mode while line is evaluated, so it sends the signal.
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	// eval runs code on the loop and waits until it is done or interrupted.
+	eval := func(code string) ([]string, error) {
+		type result struct {
+			values []string
+			err    error
+		}
+		done := make(chan result, 1)
+		loop.Call(func() {
+			if err := s.Eval(co, code, func(ret []lua.LValue, err error) {
+				done <- result{formatValues(ret), err}
+			}); err != nil {
+				done <- result{nil, err}
+			}
+		})
+		select {
+		case <-interrupt:
+		default:
+		}
+		select {
+		case r := <-done:
+			return r.values, r.err
+		case <-interrupt:
+			return nil, errInterrupted
+		}
+	}
+
+	for _, name := range replModules {
+		if _, err := eval(fmt.Sprintf("%s = require(%q)", name, name)); err != nil {
+			return err
+		}
+	}
+	if *scriptFile != "" {
+		code, err := ioutil.ReadFile(*scriptFile)
+		if err != nil {
+			return err
+		}
+		done := make(chan struct{})
+		loop.Call(func() {
+			err = settings.run(s, co, *scriptFile, string(code))
+			close(done)
+		})
+		<-done
+		if err != nil {
+			fmt.Fprintln(rl.Stderr(), color.Red(err.Error()))
+		}
+	}
+
+	var lines []string
+	for {
+		line, err := rl.Readline()
+		if err == readline.ErrInterrupt {
+			// Ctrl+C drops unfinished input.
+			lines = nil
+			rl.SetPrompt(color.Green("> "))
+			continue
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		lines = append(lines, line)
+		code := strings.Join(lines, "\n")
+		if strings.TrimSpace(code) == "" {
+			lines = nil
+			continue
+		}
+		values, err := eval(code)
+		if script.IsIncomplete(err) {
+			rl.SetPrompt(color.Green(">> "))
+			continue
+		}
+		lines = nil
+		rl.SetPrompt(color.Green("> "))
+
+		switch {
+		case err != nil:
+			fmt.Fprintln(rl.Stderr(), color.Red(strings.TrimSpace(err.Error())))
+		case len(values) > 0:
+			fmt.Fprintln(rl.Stdout(), strings.Join(values, "\t"))
+		}
+	}
+}
+
+func formatValues(values []lua.LValue) []string {
+	ret := make([]string, len(values))
+	for i, v := range values {
+		if s, ok := v.(lua.LString); ok {
+			ret[i] = strconv.Quote(string(s))
+		} else {
+			ret[i] = v.String()
+		}
+	}
+	return ret
+}
@@ -4,6 +4,8 @@ import (
 	"github.com/gobwas/gws/lua/mod"
 	"github.com/yuin/gopher-lua"
 	"io"
+	"path/filepath"
+	"strings"
 )
 
 type Script struct {
@@ -24,6 +26,86 @@ func (s *Script) Do(code string) error {
 	return s.luaState.DoString(code)
 }
 
+// DoFile runs code with the file name used as chunk name in error messages.
+func (s *Script) DoFile(file, code string) error {
+	fn, err := s.luaState.Load(strings.NewReader(code), file)
+	if err != nil {
+		return err
+	}
+	s.luaState.Push(fn)
+	return s.luaState.PCall(0, lua.MultRet, nil)
+}
+
+// DoFileCoroutine is like DoFile but runs code in a coroutine.
+func (s *Script) DoFileCoroutine(co *mod.Coroutines, file, code string) error {
+	fn, err := s.luaState.Load(strings.NewReader(code), file)
+	if err != nil {
+		return err
+	}
+	return co.Spawn(s.luaState, fn)
+}
+
+// Eval runs a line of code in a coroutine and calls done when it finishes.
+// Line is tried as an expression first, so done receives its values; for
+// statements values are nil. Syntax errors are returned immediately;
+// IsIncomplete tells if more lines could fix them.
+func (s *Script) Eval(co *mod.Coroutines, code string, done func([]lua.LValue, error)) error {
+	// Expression is passed to a function instead of being returned directly,
+	// because yield from a tail call finishes the coroutine. The function
+	// also returns number of values, which Resume does not report.
+	fn, err := s.luaState.Load(strings.NewReader(`return (function(...) return select("#", ...), ... end)(`+code+"\n)"), "stdin")
+	if err == nil {
+		co.Go(s.luaState, fn, func(values []lua.LValue, err error) {
+			if err != nil {
+				done(nil, err)
+				return
+			}
+			n := int(lua.LVAsNumber(values[0]))
+			done(values[1:1+n], nil)
+		})
+		return nil
+	}
+	fn, err = s.luaState.Load(strings.NewReader(code), "stdin")
+	if err != nil {
+		return err
+	}
+	co.Go(s.luaState, fn, func(_ []lua.LValue, err error) {
+		done(nil, err)
+	})
+	return nil
+}
+
+// IsIncomplete reports whether err is a syntax error caused by unexpected end
+// of the code.
+func IsIncomplete(err error) bool {
+	e, ok := err.(*lua.ApiError)
+	return ok && e.Type == lua.ApiErrorSyntax && strings.Contains(e.Object.String(), "at EOF:")
+}
+
+// SetPath prepends given directories to the package.path, making require()
+// to look up modules in them.
+func (s *Script) SetPath(dirs ...string) {
+	var paths []string
+	for _, dir := range dirs {
+		paths = append(paths,
+			filepath.Join(dir, "?.lua"),
+			filepath.Join(dir, "?", "init.lua"),
+		)
+	}
+
+	pkg := s.luaState.GetGlobal("package")
+	current := s.luaState.GetField(pkg, "path").String()
+	if current != "" {
+		paths = append(paths, current)
+	}
+	s.luaState.SetField(pkg, "path", lua.LString(strings.Join(paths, ";")))
+}
+
+// SetErrorHandler sets handler of errors raised by lua callbacks.
+func (s *Script) SetErrorHandler(h mod.ErrorHandler) {
+	mod.SetErrorHandler(s.luaState, h)
+}
+
 func (s *Script) Shutdown() {
 	s.luaState.Close()
 }
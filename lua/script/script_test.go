@@ -0,0 +1,169 @@
+package script
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gobwas/gws/ev"
+	"github.com/gobwas/gws/lua/mod"
+	"github.com/yuin/gopher-lua"
+)
+
+func TestEval(t *testing.T) {
+	// Loop finishes when it has nothing to do, so each line is evaluated on
+	// its own loop.
+	var (
+		loop *ev.Loop
+		co   *mod.Coroutines
+	)
+	s := New()
+	defer s.Shutdown()
+	// sleep(ms, ...) yields and returns its arguments after ms milliseconds.
+	s.luaState.SetGlobal("sleep", s.luaState.NewFunction(func(L *lua.LState) int {
+		ms := L.CheckNumber(1)
+		var args []lua.LValue
+		for i := 2; i <= L.GetTop(); i++ {
+			args = append(args, L.Get(i))
+		}
+		return co.Yield(L, func(resume func(...lua.LValue)) {
+			loop.Timeout(time.Duration(ms)*time.Millisecond, false, func() {
+				resume(args...)
+			})
+		})
+	}))
+
+	for _, test := range []struct {
+		code   string
+		values []string
+		err    bool
+	}{
+		{code: "1 + 1", values: []string{"2"}},
+		{code: "nil, 'a'", values: []string{"nil", "a"}},
+		{code: "x = 10"},
+		{code: "x", values: []string{"10"}},
+		{code: "sleep(10, 'a', x)", values: []string{"a", "10"}},
+		{code: "local v = sleep(10, 'b'); y = v"},
+		{code: "y", values: []string{"b"}},
+		{code: "error('boom')", err: true},
+	} {
+		loop = ev.NewLoop()
+		loop.SetClock(ev.NewVirtualClock(time.Unix(0, 0)))
+		co = mod.NewCoroutines(loop)
+
+		var (
+			values []string
+			err    error
+			called bool
+		)
+		if e := s.Eval(co, test.code, func(ret []lua.LValue, e error) {
+			for _, v := range ret {
+				values = append(values, v.String())
+			}
+			err, called = e, true
+		}); e != nil {
+			t.Fatalf("Eval(%q) error: %s", test.code, e)
+		}
+		loop.Run()
+		<-loop.Done()
+
+		if !called {
+			t.Errorf("Eval(%q) did not finish", test.code)
+			continue
+		}
+		if (err != nil) != test.err {
+			t.Errorf("Eval(%q) error is %v; want error %v", test.code, err, test.err)
+		}
+		if !reflect.DeepEqual(values, test.values) {
+			t.Errorf("Eval(%q) = %q; want %q", test.code, values, test.values)
+		}
+	}
+}
+
+func TestIsIncomplete(t *testing.T) {
+	loop := ev.NewLoop()
+	co := mod.NewCoroutines(loop)
+	s := New()
+	defer s.Shutdown()
+
+	for _, test := range []struct {
+		code       string
+		incomplete bool
+	}{
+		{"if x then", true},
+		{"local t = {", true},
+		{"f(1,", true},
+		{"x = = 1", false},
+		{"local 1", false},
+	} {
+		err := s.Eval(co, test.code, func([]lua.LValue, error) {
+			t.Errorf("Eval(%q) must not run the code", test.code)
+		})
+		if err == nil {
+			t.Errorf("Eval(%q) error is nil; want syntax error", test.code)
+			continue
+		}
+		if got := IsIncomplete(err); got != test.incomplete {
+			t.Errorf("IsIncomplete(%q) = %v; want %v (%s)", test.code, got, test.incomplete, err)
+		}
+	}
+}
+
+func TestSetPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Script directory goes first and search path directories after it, as
+	// -lua-path flag does.
+	files := map[string]string{
+		"script/sibling.lua":  `return "sibling"`,
+		"script/shadow.lua":   `return "script"`,
+		"path/shadow.lua":     `return "path"`,
+		"path/lib/init.lua":   `return "lib"`,
+		"path/lib/nested.lua": `return "nested"`,
+		"other/unreached.lua": `return "unreached"`,
+	}
+	for name, code := range files {
+		file := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(code), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := New()
+	defer s.Shutdown()
+	s.SetPath(filepath.Join(dir, "script"), filepath.Join(dir, "path"))
+
+	for _, test := range []struct {
+		module string
+		value  string
+		err    bool
+	}{
+		{module: "sibling", value: "sibling"},
+		{module: "shadow", value: "script"},
+		{module: "lib", value: "lib"},
+		{module: "lib.nested", value: "nested"},
+		{module: "unreached", err: true},
+	} {
+		err := s.Do(`value = require("` + test.module + `")`)
+		if (err != nil) != test.err {
+			t.Errorf("require(%q) error is %v; want error %v", test.module, err, test.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got := s.luaState.GetGlobal("value").String(); got != test.value {
+			t.Errorf("require(%q) = %q; want %q", test.module, got, test.value)
+		}
+	}
+}
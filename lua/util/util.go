@@ -1,6 +1,8 @@
 package util
 
 import (
+	"errors"
+	"fmt"
 	"github.com/yuin/gopher-lua"
 	"net/http"
 )
@@ -45,3 +47,78 @@ func HeadersFromTable(t *lua.LTable) (h http.Header) {
 	})
 	return
 }
+
+// Table is a lua table converted to go value by ToGo.
+type Table []Pair
+
+// Pair is a key and value pair of Table.
+type Pair struct {
+	Key, Value interface{}
+}
+
+// maxDepth limits nesting of converted tables to catch reference cycles.
+const maxDepth = 100
+
+// ToGo converts lua value to go value which is safe to pass to other lua
+// states. Nil, booleans, numbers, strings and tables of them are supported.
+func ToGo(v lua.LValue) (interface{}, error) {
+	return toGo(v, 0)
+}
+
+func toGo(v lua.LValue, depth int) (interface{}, error) {
+	switch x := v.(type) {
+	case *lua.LNilType:
+		return nil, nil
+	case lua.LBool:
+		return bool(x), nil
+	case lua.LNumber:
+		return float64(x), nil
+	case lua.LString:
+		return string(x), nil
+	case *lua.LTable:
+		if depth >= maxDepth {
+			return nil, errors.New("table is nested too deeply or has a reference cycle")
+		}
+		var (
+			t   Table
+			err error
+		)
+		x.ForEach(func(key, value lua.LValue) {
+			if err != nil {
+				return
+			}
+			var p Pair
+			if p.Key, err = toGo(key, depth+1); err != nil {
+				return
+			}
+			if p.Value, err = toGo(value, depth+1); err != nil {
+				return
+			}
+			t = append(t, p)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return t, nil
+	}
+	return nil, fmt.Errorf("unsupported value type %s", v.Type())
+}
+
+// FromGo converts value returned by ToGo back to lua value.
+func FromGo(L *lua.LState, v interface{}) lua.LValue {
+	switch x := v.(type) {
+	case bool:
+		return lua.LBool(x)
+	case float64:
+		return lua.LNumber(x)
+	case string:
+		return lua.LString(x)
+	case Table:
+		t := L.CreateTable(0, len(x))
+		for _, p := range x {
+			t.RawSet(FromGo(L, p.Key), FromGo(L, p.Value))
+		}
+		return t
+	}
+	return lua.LNil
+}
@@ -0,0 +1,197 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"log"
+	"sync"
+	"time"
+
+	modWS "github.com/gobwas/gws/lua/mod/ws"
+	"github.com/gobwas/gws/lua/script"
+	"github.com/gobwas/gws/ws"
+	"github.com/yuin/gopher-lua"
+)
+
+const (
+	eventOpen    = "open"
+	eventClose   = "close"
+	eventMessage = "message"
+)
+
+// Hook runs lua callbacks registered by script via "proxy" module.
+//
+// Message callback receives connection id, direction and message table with
+// "kind", "data" and "binary" fields, like messages of "ws" module. It could
+// return:
+//
+//	nil or true to pass message as is;
+//	false to drop message;
+//	string to replace message data;
+//	table with optional "data", "binary", "delay" (in milliseconds) and "drop" fields.
+type Hook struct {
+	mu        sync.Mutex
+	script    *script.Script
+	conns     map[uint64]*Conn
+	callbacks map[string]callback
+}
+
+type callback struct {
+	fn    *lua.LFunction
+	state *lua.LState
+}
+
+func NewHook(file string) (*Hook, error) {
+	code, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &Hook{
+		script:    script.New(),
+		conns:     make(map[uint64]*Conn),
+		callbacks: make(map[string]callback),
+	}
+	h.script.Preload("proxy", h)
+
+	if err := h.script.Do(string(code)); err != nil {
+		h.script.Shutdown()
+		return nil, err
+	}
+
+	return h, nil
+}
+
+func (h *Hook) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.script.Shutdown()
+}
+
+func (h *Hook) Exports() lua.LGFunction {
+	return func(L *lua.LState) int {
+		mod := L.NewTable()
+
+		mod.RawSetString("upstream", lua.LNumber(ToUpstream))
+		mod.RawSetString("client", lua.LNumber(ToClient))
+
+		mod.RawSetString("on", L.NewClosure(func(L *lua.LState) int {
+			name := L.ToString(1)
+			cb := L.ToFunction(2)
+			h.callbacks[name] = callback{cb, L}
+			return 0
+		}))
+
+		mod.RawSetString("send", L.NewClosure(func(L *lua.LState) int {
+			id := uint64(L.ToNumber(1))
+			dir := Direction(L.ToNumber(2))
+			msg := ws.MessageRaw{Kind: ws.TextMessage, Data: []byte(L.ToString(3))}
+			if opts := L.ToTable(4); opts != nil && lua.LVAsBool(opts.RawGetString("binary")) {
+				msg.Kind = ws.BinaryMessage
+			}
+
+			conn, ok := h.conns[id]
+			if !ok {
+				L.Push(lua.LString("unknown connection"))
+				return 1
+			}
+			if err := conn.Send(dir, msg); err != nil {
+				log.Printf("#%d hook send error: %s", id, err)
+				L.Push(lua.LString(err.Error()))
+				return 1
+			}
+			return 0
+		}))
+
+		L.Push(mod)
+		return 1
+	}
+}
+
+func (h *Hook) OnOpen(c *Conn, uri string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.conns[c.ID] = c
+	h.call(eventOpen, 0, lua.LNumber(c.ID), lua.LString(uri))
+}
+
+func (h *Hook) OnClose(c *Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.conns, c.ID)
+	h.call(eventClose, 0, lua.LNumber(c.ID))
+}
+
+// OnMessage calls message callback. It returns probably modified message,
+// delay before it should be relayed and false if message should be dropped.
+func (h *Hook) OnMessage(c *Conn, dir Direction, msg ws.MessageRaw) (ws.MessageRaw, time.Duration, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	cb, ok := h.callbacks[eventMessage]
+	if !ok {
+		return msg, 0, true
+	}
+
+	table := modWS.MessageToTable(cb.state, msg)
+
+	ret := h.call(eventMessage, 1, lua.LNumber(c.ID), lua.LNumber(dir), table)
+	switch v := ret.(type) {
+	case lua.LBool:
+		return msg, 0, bool(v)
+
+	case lua.LString:
+		msg.Data = []byte(v)
+		return msg, 0, true
+
+	case *lua.LTable:
+		if lua.LVAsBool(v.RawGetString("drop")) {
+			return msg, 0, false
+		}
+		if data, ok := v.RawGetString("data").(lua.LString); ok {
+			msg.Data = []byte(data)
+		}
+		if binary, ok := v.RawGetString("binary").(lua.LBool); ok {
+			if binary {
+				msg.Kind = ws.BinaryMessage
+			} else {
+				msg.Kind = ws.TextMessage
+			}
+		}
+		var delay time.Duration
+		if ms, ok := v.RawGetString("delay").(lua.LNumber); ok {
+			delay = time.Duration(float64(ms) * float64(time.Millisecond))
+		}
+		return msg, delay, true
+	}
+
+	return msg, 0, true
+}
+
+// call calls callback for the event if it exists. It returns first returned
+// value if nret is positive.
+// It must be called with h.mu held.
+func (h *Hook) call(event string, nret int, args ...lua.LValue) lua.LValue {
+	cb, ok := h.callbacks[event]
+	if !ok {
+		return lua.LNil
+	}
+
+	err := cb.state.CallByParam(lua.P{
+		Fn:      cb.fn,
+		NRet:    nret,
+		Protect: true,
+	}, args...)
+	if err != nil {
+		log.Printf("hook %q error: %s", event, err)
+		return lua.LNil
+	}
+	if nret == 0 {
+		return lua.LNil
+	}
+
+	ret := cb.state.Get(-1)
+	cb.state.Pop(1)
+	return ret
+}
@@ -0,0 +1,321 @@
+// Package proxy brings websocket man-in-the-middle proxy.
+package proxy
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gobwas/gws/cli/color"
+	"github.com/gobwas/gws/config"
+	"github.com/gobwas/gws/ws"
+	"github.com/gorilla/websocket"
+)
+
+var hookFile = flag.String("hook", "", "path to lua script with proxy hooks")
+
+// Direction describes the way of relayed message.
+type Direction int
+
+const (
+	ToUpstream Direction = iota
+	ToClient
+)
+
+func (d Direction) String() string {
+	switch d {
+	case ToUpstream:
+		return "client > upstream"
+	case ToClient:
+		return "client < upstream"
+	default:
+		return "unknown direction"
+	}
+}
+
+// skipHeaders are not passed to upstream.
+// They are set by dialer or are hop-by-hop headers.
+var skipHeaders = map[string]bool{
+	"Upgrade":                  true,
+	"Connection":               true,
+	"Sec-Websocket-Key":        true,
+	"Sec-Websocket-Version":    true,
+	"Sec-Websocket-Extensions": true,
+	"Keep-Alive":               true,
+	"Te":                       true,
+	"Trailer":                  true,
+	"Transfer-Encoding":        true,
+	"Proxy-Authorization":      true,
+	"Proxy-Connection":         true,
+}
+
+func Go(c config.Config) error {
+	upstream, err := url.Parse(c.URI)
+	if err != nil {
+		return err
+	}
+
+	var hook *Hook
+	if *hookFile != "" {
+		hook, err = NewHook(*hookFile)
+		if err != nil {
+			return err
+		}
+		defer hook.Close()
+	}
+
+	p := &proxy{
+		upstream: upstream,
+		headers:  c.Headers,
+		hook:     hook,
+	}
+
+	log.Printf("ready to listen %s and proxy to %s", c.Addr, c.URI)
+	return http.ListenAndServe(c.Addr, p)
+}
+
+type proxy struct {
+	upstream *url.URL
+	headers  http.Header
+	hook     *Hook
+	nextID   uint64
+}
+
+func (p *proxy) target(r *http.Request) string {
+	u := *p.upstream
+	u.Path = strings.TrimSuffix(u.Path, "/") + r.URL.Path
+	switch {
+	case u.RawQuery == "":
+		u.RawQuery = r.URL.RawQuery
+	case r.URL.RawQuery != "":
+		u.RawQuery += "&" + r.URL.RawQuery
+	}
+	return u.String()
+}
+
+func (p *proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := atomic.AddUint64(&p.nextID, 1)
+
+	headers := make(http.Header)
+	for key, values := range r.Header {
+		if !skipHeaders[key] {
+			headers[key] = values
+		}
+	}
+	for key, values := range p.headers {
+		if _, ok := headers[key]; !ok {
+			headers[key] = values
+		}
+	}
+
+	target := p.target(r)
+	up, resp, err := ws.GetConn(target, headers)
+	if err != nil {
+		log.Printf("#%d could not connect to upstream %s: %s", id, target, err)
+		status := http.StatusBadGateway
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	defer up.Close()
+
+	// Pass chosen subprotocol back to the client.
+	respHeaders := make(http.Header)
+	if proto := resp.Header.Get("Sec-Websocket-Protocol"); proto != "" {
+		respHeaders.Set("Sec-Websocket-Protocol", proto)
+	}
+	// Origin is passed to upstream, which is the one to check it.
+	upgrade := ws.GetUpgrader(ws.UpgradeConfig{Origin: "*", Headers: respHeaders})
+	down, err := upgrade(w, r)
+	if err != nil {
+		log.Printf("#%d could not upgrade client connection: %s", id, err)
+		return
+	}
+	defer down.Close()
+
+	log.Printf("#%d %s connected %s %s %s", id, r.RemoteAddr, r.URL.RequestURI(), color.Cyan("<>"), target)
+
+	conn := &Conn{
+		ID:       id,
+		client:   newPeer(down),
+		upstream: newPeer(up),
+	}
+
+	// Both relays and both writers report when they are done.
+	done := make(chan struct{}, 4)
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, dst := range []*peer{conn.client, conn.upstream} {
+		wg.Add(1)
+		go func(dst *peer) {
+			defer wg.Done()
+			dst.loop(stop, done)
+		}(dst)
+	}
+	defer func() {
+		close(stop)
+		wg.Wait()
+	}()
+
+	if p.hook != nil {
+		p.hook.OnOpen(conn, r.URL.RequestURI())
+		defer p.hook.OnClose(conn)
+	}
+
+	go p.relay(conn, ToUpstream, done)
+	go p.relay(conn, ToClient, done)
+	<-done
+
+	log.Printf("#%d disconnected", id)
+}
+
+func (p *proxy) relay(c *Conn, dir Direction, done chan<- struct{}) {
+	defer func() { done <- struct{}{} }()
+
+	src, dst := c.peers(dir)
+	src.conn.SetPingHandler(func(data string) error {
+		log.Printf("#%d %s %s: %q", c.ID, dir, color.Magenta(ws.Kind(ws.PingMessage)), data)
+		return dst.write(ws.MessageRaw{Kind: ws.PingMessage, Data: []byte(data)})
+	})
+	src.conn.SetPongHandler(func(data string) error {
+		log.Printf("#%d %s %s: %q", c.ID, dir, color.Magenta(ws.Kind(ws.PongMessage)), data)
+		return dst.write(ws.MessageRaw{Kind: ws.PongMessage, Data: []byte(data)})
+	})
+
+	for {
+		msg, err := ws.ReadFromConn(src.conn)
+		if err != nil {
+			if ce, ok := err.(*websocket.CloseError); ok {
+				log.Printf("#%d %s %s: %d %q", c.ID, dir, color.Magenta(ws.Kind(ws.CloseMessage)), ce.Code, ce.Text)
+				// Abnormal closure code must not be sent over the wire.
+				if ce.Code != websocket.CloseAbnormalClosure {
+					dst.write(ws.MessageRaw{Kind: ws.CloseMessage, Data: websocket.FormatCloseMessage(ce.Code, ce.Text)})
+				}
+			} else {
+				log.Printf("#%d %s %s", c.ID, dir, color.Red(err))
+			}
+			return
+		}
+
+		log.Printf("#%d %s %s: %s", c.ID, dir, color.Magenta(msg.Kind), color.Cyan(string(msg.Data)))
+
+		var delay time.Duration
+		if p.hook != nil {
+			var pass bool
+			msg, delay, pass = p.hook.OnMessage(c, dir, msg)
+			if !pass {
+				log.Printf("#%d %s %s", c.ID, dir, color.Yellow("dropped by hook"))
+				continue
+			}
+		}
+		if delay > 0 {
+			time.Sleep(delay)
+		}
+
+		if err := dst.write(msg); err != nil {
+			log.Printf("#%d %s %s", c.ID, dir, color.Red(err))
+			return
+		}
+	}
+}
+
+// Conn represents pair of proxied connections.
+type Conn struct {
+	ID       uint64
+	client   *peer
+	upstream *peer
+}
+
+// Send writes message to the client or to the upstream depending on dir. It
+// does not wait for the write, but keeps order with relayed messages.
+func (c *Conn) Send(dir Direction, msg ws.MessageRaw) error {
+	_, dst := c.peers(dir)
+	log.Printf("#%d %s %s: %s", c.ID, dir, color.Yellow("injected"), color.Cyan(string(msg.Data)))
+	return dst.write(msg)
+}
+
+func (c *Conn) peers(dir Direction) (src, dst *peer) {
+	if dir == ToUpstream {
+		return c.client, c.upstream
+	}
+	return c.upstream, c.client
+}
+
+// peer writes messages queued by relays and hook to the websocket connection
+// in the same order.
+type peer struct {
+	conn *websocket.Conn
+	wake chan struct{}
+
+	mu    sync.Mutex
+	queue []ws.MessageRaw
+	err   error
+}
+
+func newPeer(conn *websocket.Conn) *peer {
+	return &peer{
+		conn: conn,
+		wake: make(chan struct{}, 1),
+	}
+}
+
+// write queues message. It returns error of previous writes.
+func (p *peer) write(msg ws.MessageRaw) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	p.queue = append(p.queue, msg)
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// loop writes queued messages until stop is closed, and then writes the rest
+// of them, like close frame sent by the relay which is done. It reports to
+// done when write fails.
+func (p *peer) loop(stop <-chan struct{}, done chan<- struct{}) {
+	for {
+		var stopped bool
+		select {
+		case <-p.wake:
+		case <-stop:
+			stopped = true
+		}
+		p.mu.Lock()
+		queue := p.queue
+		p.queue = nil
+		p.mu.Unlock()
+
+		for _, msg := range queue {
+			if err := p.send(msg); err != nil {
+				p.mu.Lock()
+				p.err = err
+				p.mu.Unlock()
+				done <- struct{}{}
+				return
+			}
+		}
+		if stopped {
+			return
+		}
+	}
+}
+
+func (p *peer) send(msg ws.MessageRaw) error {
+	switch msg.Kind {
+	case ws.PingMessage, ws.PongMessage, ws.CloseMessage:
+		return p.conn.WriteControl(int(msg.Kind), msg.Data, time.Now().Add(time.Second))
+	}
+	return ws.WriteToConn(p.conn, msg.Kind, msg.Data)
+}
@@ -0,0 +1,151 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gobwas/gws/ws"
+)
+
+// echoUpstream starts websocket server which sends received messages back
+// and reports Origin headers of handshakes.
+func echoUpstream(t *testing.T) (*httptest.Server, <-chan string) {
+	origins := make(chan string, 1)
+	upgrade := ws.GetUpgrader(ws.UpgradeConfig{Origin: "*"})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origins <- r.Header.Get(ws.HeaderOrigin)
+		conn, err := upgrade(w, r)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		for {
+			msg, err := ws.ReadFromConn(conn)
+			if err != nil {
+				return
+			}
+			if err := ws.WriteToConn(conn, msg.Kind, msg.Data); err != nil {
+				return
+			}
+		}
+	}))
+	return srv, origins
+}
+
+// startProxy starts proxy to the upstream server and returns its websocket
+// address.
+func startProxy(t *testing.T, upstream *httptest.Server, hook *Hook) (*httptest.Server, string) {
+	u, err := url.Parse(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.Scheme = "ws"
+	srv := httptest.NewServer(&proxy{upstream: u, hook: hook})
+	return srv, "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func TestProxyRelay(t *testing.T) {
+	upstream, origins := echoUpstream(t)
+	defer upstream.Close()
+	srv, addr := startProxy(t, upstream, nil)
+	defer srv.Close()
+
+	// Origin of other host must not be refused by proxy.
+	h := http.Header{}
+	h.Set(ws.HeaderOrigin, "http://example.com")
+	conn, _, err := ws.GetConn(addr, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if origin := <-origins; origin != "http://example.com" {
+		t.Errorf("upstream got origin %q; want %q", origin, "http://example.com")
+	}
+
+	for _, msg := range []ws.MessageRaw{
+		{Kind: ws.TextMessage, Data: []byte("hello")},
+		{Kind: ws.BinaryMessage, Data: []byte{0, 1, 2}},
+	} {
+		if err := ws.WriteToConn(conn, msg.Kind, msg.Data); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ws.ReadFromConn(conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Kind != msg.Kind || string(got.Data) != string(msg.Data) {
+			t.Errorf("got %v %q; want %v %q", got.Kind, got.Data, msg.Kind, msg.Data)
+		}
+	}
+}
+
+func TestProxyHook(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "hook.lua")
+	err = ioutil.WriteFile(file, []byte(`
+		local proxy = require("proxy")
+		proxy.on("message", function(id, dir, msg)
+			if dir == proxy.client then
+				return
+			end
+			if msg.data == "drop" then
+				return false
+			end
+			proxy.send(id, proxy.upstream, "before " .. msg.data)
+			return "hooked " .. msg.data
+		end)
+	`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hook, err := NewHook(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hook.Close()
+
+	upstream, _ := echoUpstream(t)
+	defer upstream.Close()
+	srv, addr := startProxy(t, upstream, hook)
+	defer srv.Close()
+
+	conn, _, err := ws.GetConn(addr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var expect []string
+	for _, data := range []string{"a", "drop", "b", "c"} {
+		if err := ws.WriteToConn(conn, ws.TextMessage, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+		if data != "drop" {
+			expect = append(expect, "before "+data, "hooked "+data)
+		}
+	}
+	// Injected message must reach upstream before the relayed one, so the
+	// echoed order is the same for every message.
+	var got []string
+	for range expect {
+		msg, err := ws.ReadFromConn(conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, string(msg.Data))
+	}
+	if strings.Join(got, ",") != strings.Join(expect, ",") {
+		t.Errorf("got messages %q; want %q", got, expect)
+	}
+}
@@ -0,0 +1,384 @@
+package server
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	authBearer = "bearer"
+	authBasic  = "basic"
+	authHeader = "header"
+	authQuery  = "query"
+	authHMAC   = "hmac"
+	authJWT    = "jwt"
+)
+
+// Query parameters used by hmac authorization.
+const (
+	paramSignature = "signature"
+	paramExpires   = "expires"
+	paramUser      = "user"
+)
+
+var (
+	// ErrNoCredentials is returned when request has no credentials.
+	// It leads to 401 response.
+	ErrNoCredentials = errors.New("no credentials")
+	// ErrBadCredentials is returned when request has invalid credentials.
+	// It leads to 403 response.
+	ErrBadCredentials = errors.New("invalid credentials")
+)
+
+// Authorizer checks handshake request and returns identity of the client.
+type Authorizer interface {
+	Authorize(*http.Request) (string, error)
+}
+
+// AuthorizerFunc is an adapter to allow use of ordinary functions as Authorizer.
+type AuthorizerFunc func(*http.Request) (string, error)
+
+func (fn AuthorizerFunc) Authorize(r *http.Request) (string, error) {
+	return fn(r)
+}
+
+// ParseAuth creates Authorizer from rule in format "kind:params".
+// Supported rules are:
+//
+//	bearer:TOKEN
+//	basic:USER:PASSWORD
+//	header:NAME=VALUE
+//	query:NAME=VALUE
+//	hmac:SECRET
+//	jwt:KEYFILE
+func ParseAuth(rule string) (Authorizer, error) {
+	i := strings.IndexByte(rule, ':')
+	if i == -1 {
+		return nil, fmt.Errorf("malformed auth rule %q: expecting kind:params", rule)
+	}
+	kind, params := rule[:i], rule[i+1:]
+
+	switch kind {
+	case authBearer:
+		return bearerAuth(params), nil
+
+	case authBasic:
+		j := strings.IndexByte(params, ':')
+		if j == -1 {
+			return nil, fmt.Errorf("malformed basic auth rule: expecting basic:user:password")
+		}
+		return basicAuth(params[:j], params[j+1:]), nil
+
+	case authHeader, authQuery:
+		j := strings.IndexByte(params, '=')
+		if j == -1 {
+			return nil, fmt.Errorf("malformed %s auth rule: expecting %s:name=value", kind, kind)
+		}
+		name, value := params[:j], params[j+1:]
+		if kind == authHeader {
+			return matchAuth(name, value, func(r *http.Request) string {
+				return r.Header.Get(name)
+			}), nil
+		}
+		return matchAuth(name, value, func(r *http.Request) string {
+			return r.URL.Query().Get(name)
+		}), nil
+
+	case authHMAC:
+		if params == "" {
+			return nil, fmt.Errorf("hmac secret is empty")
+		}
+		return hmacAuth([]byte(params)), nil
+
+	case authJWT:
+		return newJWTAuth(params)
+
+	default:
+		return nil, fmt.Errorf("unknown auth kind: %q", kind)
+	}
+}
+
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+func bearerToken(r *http.Request) string {
+	h := r.Header.Get("Authorization")
+	if len(h) > 7 && strings.EqualFold(h[:7], "bearer ") {
+		return strings.TrimSpace(h[7:])
+	}
+	return ""
+}
+
+func bearerAuth(token string) Authorizer {
+	return AuthorizerFunc(func(r *http.Request) (string, error) {
+		t := bearerToken(r)
+		if t == "" {
+			return "", ErrNoCredentials
+		}
+		if !equal(t, token) {
+			return "", ErrBadCredentials
+		}
+		return authBearer, nil
+	})
+}
+
+func basicAuth(user, password string) Authorizer {
+	return challengeAuth{
+		Authorizer: AuthorizerFunc(func(r *http.Request) (string, error) {
+			u, p, ok := r.BasicAuth()
+			if !ok {
+				return "", ErrNoCredentials
+			}
+			if !equal(u, user) || !equal(p, password) {
+				return "", ErrBadCredentials
+			}
+			return u, nil
+		}),
+		challenge: `Basic realm="gws"`,
+	}
+}
+
+// challengeAuth is an Authorizer which asks for specific authentication
+// scheme in WWW-Authenticate header of 401 response.
+type challengeAuth struct {
+	Authorizer
+	challenge string
+}
+
+func (c challengeAuth) Challenge() string {
+	return c.challenge
+}
+
+// challenge returns WWW-Authenticate header value for the authorizer.
+func challenge(a Authorizer) string {
+	if c, ok := a.(interface{ Challenge() string }); ok {
+		return c.Challenge()
+	}
+	return `Bearer realm="gws"`
+}
+
+func matchAuth(name, value string, get func(*http.Request) string) Authorizer {
+	return AuthorizerFunc(func(r *http.Request) (string, error) {
+		v := get(r)
+		if v == "" {
+			return "", ErrNoCredentials
+		}
+		if !equal(v, value) {
+			return "", ErrBadCredentials
+		}
+		return name + "=" + v, nil
+	})
+}
+
+// hmacAuth checks that query has hex encoded HMAC-SHA256 signature of the
+// path and the rest of query parameters (see SignQuery). Optional "expires"
+// parameter is treated as unix timestamp of signature expiration.
+func hmacAuth(secret []byte) Authorizer {
+	return AuthorizerFunc(func(r *http.Request) (string, error) {
+		query := r.URL.Query()
+		signature := query.Get(paramSignature)
+		if signature == "" {
+			return "", ErrNoCredentials
+		}
+		query.Del(paramSignature)
+
+		if !equal(signature, SignQuery(secret, r.URL.Path, query)) {
+			return "", ErrBadCredentials
+		}
+		if e := query.Get(paramExpires); e != "" {
+			expires, err := strconv.ParseInt(e, 10, 64)
+			if err != nil || time.Now().Unix() > expires {
+				return "", ErrBadCredentials
+			}
+		}
+		if user := query.Get(paramUser); user != "" {
+			return user, nil
+		}
+		return authHMAC, nil
+	})
+}
+
+// SignQuery returns hex encoded HMAC-SHA256 signature of the path and
+// query parameters sorted by key.
+func SignQuery(secret []byte, path string, query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(path))
+	for _, key := range keys {
+		for _, value := range query[key] {
+			fmt.Fprintf(mac, "\n%s=%s", key, value)
+		}
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// jwtAuth verifies JWT passed as bearer token or "token" query parameter.
+// It supports HS256 algorithm if key file contains raw secret, and RS256 or
+// ES256 if key file contains PEM encoded public key.
+type jwtAuth struct {
+	secret []byte
+	key    crypto.PublicKey
+}
+
+func newJWTAuth(file string) (*jwtAuth, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return &jwtAuth{secret: []byte(strings.TrimSpace(string(data)))}, nil
+	}
+
+	var key crypto.PublicKey
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key = cert.PublicKey
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("malformed jwt key file %q: %s", file, err)
+	}
+
+	return &jwtAuth{key: key}, nil
+}
+
+type jwtClaims struct {
+	Subject   string   `json:"sub"`
+	ExpiresAt *float64 `json:"exp"`
+	NotBefore *float64 `json:"nbf"`
+}
+
+func (j *jwtAuth) Authorize(r *http.Request) (string, error) {
+	token := bearerToken(r)
+	if token == "" {
+		token = r.URL.Query().Get("token")
+	}
+	if token == "" {
+		return "", ErrNoCredentials
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", ErrBadCredentials
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return "", ErrBadCredentials
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", ErrBadCredentials
+	}
+	if !j.verify(header.Alg, parts[0]+"."+parts[1], signature) {
+		return "", ErrBadCredentials
+	}
+
+	var claims jwtClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return "", ErrBadCredentials
+	}
+	now := float64(time.Now().Unix())
+	if claims.ExpiresAt != nil && now >= *claims.ExpiresAt {
+		return "", ErrBadCredentials
+	}
+	if claims.NotBefore != nil && now < *claims.NotBefore {
+		return "", ErrBadCredentials
+	}
+	if claims.Subject == "" {
+		return authJWT, nil
+	}
+
+	return claims.Subject, nil
+}
+
+func (j *jwtAuth) verify(alg, signed string, signature []byte) bool {
+	hash := sha256.Sum256([]byte(signed))
+
+	switch key := j.key.(type) {
+	case nil:
+		if alg != "HS256" {
+			return false
+		}
+		mac := hmac.New(sha256.New, j.secret)
+		mac.Write([]byte(signed))
+		return hmac.Equal(signature, mac.Sum(nil))
+
+	case *rsa.PublicKey:
+		return alg == "RS256" && rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], signature) == nil
+
+	case *ecdsa.PublicKey:
+		if alg != "ES256" || len(signature) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(key, hash[:], r, s)
+
+	default:
+		return false
+	}
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// writeAuthError writes response on failed authorization of a.
+// Zero status means 401 for missing and 403 for invalid credentials.
+func writeAuthError(w http.ResponseWriter, a Authorizer, err error, status int, body string) {
+	if status == 0 {
+		if err == ErrNoCredentials {
+			status = http.StatusUnauthorized
+		} else {
+			status = http.StatusForbidden
+		}
+	}
+	if body == "" {
+		body = http.StatusText(status)
+	}
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", challenge(a))
+	}
+	http.Error(w, body, status)
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseAuth(t *testing.T) {
+	for _, test := range []struct {
+		rule     string
+		target   string
+		header   map[string]string
+		identity string
+		err      error
+	}{
+		{
+			rule:   "bearer:secret",
+			target: "/",
+			err:    ErrNoCredentials,
+		},
+		{
+			rule:     "bearer:secret",
+			target:   "/",
+			header:   map[string]string{"Authorization": "Bearer secret"},
+			identity: "bearer",
+		},
+		{
+			rule:   "bearer:secret",
+			target: "/",
+			header: map[string]string{"Authorization": "Bearer wrong"},
+			err:    ErrBadCredentials,
+		},
+		{
+			rule:     "basic:user:pass",
+			target:   "/",
+			header:   map[string]string{"Authorization": "Basic " + base64.StdEncoding.EncodeToString([]byte("user:pass"))},
+			identity: "user",
+		},
+		{
+			rule:     "header:X-Key=42",
+			target:   "/",
+			header:   map[string]string{"X-Key": "42"},
+			identity: "X-Key=42",
+		},
+		{
+			rule:   "query:key=42",
+			target: "/?key=43",
+			err:    ErrBadCredentials,
+		},
+		{
+			rule:     "hmac:secret",
+			target:   "/feed?user=bob&signature=" + SignQuery([]byte("secret"), "/feed", url.Values{"user": {"bob"}}),
+			identity: "bob",
+		},
+		{
+			rule:   "hmac:secret",
+			target: "/feed?user=alice&signature=" + SignQuery([]byte("secret"), "/feed", url.Values{"user": {"bob"}}),
+			err:    ErrBadCredentials,
+		},
+		{
+			rule:   "hmac:secret",
+			target: "/feed?expires=1&signature=" + SignQuery([]byte("secret"), "/feed", url.Values{"expires": {"1"}}),
+			err:    ErrBadCredentials,
+		},
+	} {
+		auth, err := ParseAuth(test.rule)
+		if err != nil {
+			t.Fatalf("ParseAuth(%q) error: %s", test.rule, err)
+		}
+		req := httptest.NewRequest("GET", test.target, nil)
+		for key, value := range test.header {
+			req.Header.Set(key, value)
+		}
+		identity, err := auth.Authorize(req)
+		if identity != test.identity || err != test.err {
+			t.Errorf(
+				"%q: Authorize(%q) = %q, %v; want %q, %v",
+				test.rule, test.target, identity, err, test.identity, test.err,
+			)
+		}
+	}
+}
+
+func TestJWTAuth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key := filepath.Join(dir, "key")
+	if err := ioutil.WriteFile(key, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	auth, err := ParseAuth("jwt:" + key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sign := func(secret, claims string) string {
+		enc := base64.RawURLEncoding
+		data := enc.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + enc.EncodeToString([]byte(claims))
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(data))
+		return data + "." + enc.EncodeToString(mac.Sum(nil))
+	}
+
+	for _, test := range []struct {
+		token    string
+		identity string
+		err      error
+	}{
+		{sign("secret", `{"sub":"bob"}`), "bob", nil},
+		{sign("secret", `{"sub":"bob","exp":1}`), "", ErrBadCredentials},
+		{sign("wrong", `{"sub":"bob"}`), "", ErrBadCredentials},
+		{"garbage", "", ErrBadCredentials},
+	} {
+		req := httptest.NewRequest("GET", "/?token="+test.token, nil)
+		identity, err := auth.Authorize(req)
+		if identity != test.identity || err != test.err {
+			t.Errorf("Authorize(%q) = %q, %v; want %q, %v", test.token, identity, err, test.identity, test.err)
+		}
+	}
+}
+
+func TestWriteAuthErrorChallenge(t *testing.T) {
+	for _, test := range []struct {
+		rule string
+		exp  string
+	}{
+		{"bearer:secret", `Bearer realm="gws"`},
+		{"basic:user:pass", `Basic realm="gws"`},
+	} {
+		auth, err := ParseAuth(test.rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		writeAuthError(w, auth, ErrNoCredentials, 0, "")
+		if w.Code != 401 {
+			t.Errorf("%s: status is %d; want 401", test.rule, w.Code)
+		}
+		if act := w.Header().Get("WWW-Authenticate"); act != test.exp {
+			t.Errorf("%s: WWW-Authenticate is %q; want %q", test.rule, act, test.exp)
+		}
+	}
+}
@@ -2,24 +2,34 @@ package server
 
 import "fmt"
 
-type ResponderFlag struct {
+// choice is a flag value which is one of expected strings.
+type choice struct {
 	value  string
 	expect []string
 }
 
-func (r *ResponderFlag) Set(s string) error {
-	for _, e := range r.expect {
+func (c *choice) Set(s string) error {
+	for _, e := range c.expect {
 		if e == s {
-			r.value = s
+			c.value = s
 			return nil
 		}
 	}
 
-	return fmt.Errorf("expecting one of %s", r.expect)
+	return fmt.Errorf("expecting one of %s", c.expect)
 }
-func (r ResponderFlag) String() string {
-	return r.value
+func (c choice) String() string {
+	return c.value
 }
-func (r ResponderFlag) Get() interface{} {
-	return r.value
+func (c choice) Get() interface{} {
+	return c.value
 }
+
+// ResponderFlag is a name of responder.
+type ResponderFlag struct{ choice }
+
+// RateActionFlag is an action on message exceeding the rate limit.
+type RateActionFlag struct{ choice }
+
+// StreamModeFlag is a schedule of messages pushed by stream responder.
+type StreamModeFlag struct{ choice }
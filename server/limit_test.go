@@ -0,0 +1,48 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConnLimiter(t *testing.T) {
+	l := newConnLimiter(3, 2)
+
+	for i, test := range []struct {
+		ip  string
+		err error
+	}{
+		{"1.1.1.1", nil},
+		{"1.1.1.1", nil},
+		{"1.1.1.1", ErrTooManyConnsPerIP},
+		{"2.2.2.2", nil},
+		{"3.3.3.3", ErrTooManyConns},
+	} {
+		if err := l.acquire(test.ip); err != test.err {
+			t.Errorf("[%d] acquire(%q) = %v; want %v", i, test.ip, err, test.err)
+		}
+	}
+
+	l.release("1.1.1.1")
+	if err := l.acquire("3.3.3.3"); err != nil {
+		t.Errorf("acquire after release = %v; want nil", err)
+	}
+}
+
+func TestBucket(t *testing.T) {
+	b := newBucket(10, 2)
+	if !b.allow() || !b.allow() {
+		t.Fatalf("bucket does not allow burst")
+	}
+	if b.allow() {
+		t.Fatalf("bucket allows more than burst")
+	}
+	if d := b.reserve(); d <= 0 || d > 100*time.Millisecond {
+		t.Errorf("reserve() = %s; want (0, 100ms]", d)
+	}
+
+	var unlimited *bucket
+	if !unlimited.allow() || unlimited.reserve() != 0 {
+		t.Errorf("nil bucket limits messages")
+	}
+}
@@ -0,0 +1,295 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gobwas/gws/ws"
+)
+
+const (
+	failNotFound = "not_found"
+	failRejected = "rejected"
+	failLimit    = "limit"
+	failAuth     = "auth"
+	failUpgrade  = "upgrade"
+)
+
+// closeAbnormal is used when connection was closed without close frame.
+const closeAbnormal = 1006
+
+var latencyBuckets = []float64{
+	0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10,
+}
+
+type traffic struct {
+	messages uint64
+	bytes    uint64
+}
+
+// metrics holds server statistics.
+// It is able to write itself in prometheus text format.
+type metrics struct {
+	mu sync.Mutex
+
+	activeConns int64
+	totalConns  uint64
+	in          map[ws.Kind]traffic
+	out         map[ws.Kind]traffic
+	failures    map[string]uint64
+	closes      map[int]uint64
+	dropped     uint64
+
+	latencyCounts []uint64
+	latencyCount  uint64
+	latencySum    float64
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		in:            make(map[ws.Kind]traffic),
+		out:           make(map[ws.Kind]traffic),
+		failures:      make(map[string]uint64),
+		closes:        make(map[int]uint64),
+		latencyCounts: make([]uint64, len(latencyBuckets)),
+	}
+}
+
+func (m *metrics) connOpen() {
+	m.mu.Lock()
+	m.activeConns++
+	m.totalConns++
+	m.mu.Unlock()
+}
+
+func (m *metrics) connClose(code int) {
+	m.mu.Lock()
+	m.activeConns--
+	m.closes[code]++
+	m.mu.Unlock()
+}
+
+func (m *metrics) handshakeFailure(reason string) {
+	m.mu.Lock()
+	m.failures[reason]++
+	m.mu.Unlock()
+}
+
+func (m *metrics) received(kind ws.Kind, size int) {
+	m.mu.Lock()
+	t := m.in[kind]
+	t.messages++
+	t.bytes += uint64(size)
+	m.in[kind] = t
+	m.mu.Unlock()
+}
+
+func (m *metrics) sent(kind ws.Kind, size int) {
+	m.mu.Lock()
+	t := m.out[kind]
+	t.messages++
+	t.bytes += uint64(size)
+	m.out[kind] = t
+	m.mu.Unlock()
+}
+
+func (m *metrics) streamDropped(n uint64) {
+	m.mu.Lock()
+	m.dropped += n
+	m.mu.Unlock()
+}
+
+func (m *metrics) latency(d time.Duration) {
+	s := d.Seconds()
+	m.mu.Lock()
+	for i, le := range latencyBuckets {
+		if s <= le {
+			m.latencyCounts[i]++
+		}
+	}
+	m.latencyCount++
+	m.latencySum += s
+	m.mu.Unlock()
+}
+
+// snapshot is a short summary of metrics used for periodic logging.
+type snapshot struct {
+	time        time.Time
+	activeConns int64
+	totalConns  uint64
+	in, out     traffic
+}
+
+func (m *metrics) snapshot() (s snapshot) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s.time = time.Now()
+	s.activeConns = m.activeConns
+	s.totalConns = m.totalConns
+	for _, t := range m.in {
+		s.in.messages += t.messages
+		s.in.bytes += t.bytes
+	}
+	for _, t := range m.out {
+		s.out.messages += t.messages
+		s.out.bytes += t.bytes
+	}
+	return
+}
+
+// String returns the difference between s and prev snapshots in human
+// readable form.
+func (s snapshot) String(prev snapshot) string {
+	seconds := s.time.Sub(prev.time).Seconds()
+	rate := func(cur, prev uint64) float64 {
+		if seconds <= 0 {
+			return 0
+		}
+		return float64(cur-prev) / seconds
+	}
+	return fmt.Sprintf(
+		"conns: %d (+%d); in: %d (%.2f/s, %.2fB/s); out: %d (%.2f/s, %.2fB/s)",
+		s.activeConns, s.totalConns-prev.totalConns,
+		s.in.messages-prev.in.messages,
+		rate(s.in.messages, prev.in.messages),
+		rate(s.in.bytes, prev.in.bytes),
+		s.out.messages-prev.out.messages,
+		rate(s.out.messages, prev.out.messages),
+		rate(s.out.bytes, prev.out.bytes),
+	)
+}
+
+// WriteTo writes metrics in prometheus text exposition format.
+func (m *metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p := &promWriter{w: w}
+
+	p.header("gws_connections_active", "gauge", "Number of active connections.")
+	p.value("gws_connections_active", "", float64(m.activeConns))
+	p.header("gws_connections_total", "counter", "Number of established connections.")
+	p.value("gws_connections_total", "", float64(m.totalConns))
+
+	for _, d := range []struct {
+		dir  string
+		data map[ws.Kind]traffic
+	}{
+		{"received", m.in},
+		{"sent", m.out},
+	} {
+		kinds := make([]int, 0, len(d.data))
+		for kind := range d.data {
+			kinds = append(kinds, int(kind))
+		}
+		sort.Ints(kinds)
+
+		messages := "gws_messages_" + d.dir + "_total"
+		p.header(messages, "counter", "Number of "+d.dir+" messages by opcode.")
+		for _, kind := range kinds {
+			p.value(messages, label("opcode", opcode(ws.Kind(kind))), float64(d.data[ws.Kind(kind)].messages))
+		}
+		bytes := "gws_bytes_" + d.dir + "_total"
+		p.header(bytes, "counter", "Number of "+d.dir+" payload bytes by opcode.")
+		for _, kind := range kinds {
+			p.value(bytes, label("opcode", opcode(ws.Kind(kind))), float64(d.data[ws.Kind(kind)].bytes))
+		}
+	}
+
+	reasons := make([]string, 0, len(m.failures))
+	for reason := range m.failures {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	p.header("gws_handshake_failures_total", "counter", "Number of failed handshakes by reason.")
+	for _, reason := range reasons {
+		p.value("gws_handshake_failures_total", label("reason", reason), float64(m.failures[reason]))
+	}
+
+	codes := make([]int, 0, len(m.closes))
+	for code := range m.closes {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	p.header("gws_close_codes_total", "counter", "Number of closed connections by close code.")
+	for _, code := range codes {
+		p.value("gws_close_codes_total", label("code", strconv.Itoa(code)), float64(m.closes[code]))
+	}
+
+	p.header("gws_stream_dropped_total", "counter", "Number of pushed messages dropped because of slow connections.")
+	p.value("gws_stream_dropped_total", "", float64(m.dropped))
+
+	p.header("gws_response_latency_seconds", "histogram", "Time between receiving message and sending response.")
+	for i, le := range latencyBuckets {
+		p.value("gws_response_latency_seconds_bucket", label("le", strconv.FormatFloat(le, 'g', -1, 64)), float64(m.latencyCounts[i]))
+	}
+	p.value("gws_response_latency_seconds_bucket", label("le", "+Inf"), float64(m.latencyCount))
+	p.value("gws_response_latency_seconds_sum", "", m.latencySum)
+	p.value("gws_response_latency_seconds_count", "", float64(m.latencyCount))
+
+	return p.n, p.err
+}
+
+type promWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (p *promWriter) printf(format string, args ...interface{}) {
+	if p.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(p.w, format, args...)
+	p.n += int64(n)
+	p.err = err
+}
+
+func (p *promWriter) header(name, kind, help string) {
+	p.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func (p *promWriter) value(name, labels string, v float64) {
+	p.printf("%s%s %s\n", name, labels, strconv.FormatFloat(v, 'g', -1, 64))
+}
+
+func label(key, value string) string {
+	return fmt.Sprintf("{%s=%q}", key, value)
+}
+
+func opcode(k ws.Kind) string {
+	switch k {
+	case ws.TextMessage:
+		return "text"
+	case ws.BinaryMessage:
+		return "binary"
+	case ws.CloseMessage:
+		return "close"
+	case ws.PingMessage:
+		return "ping"
+	case ws.PongMessage:
+		return "pong"
+	default:
+		return strconv.Itoa(int(k))
+	}
+}
+
+// closeCode parses code from the close message data,
+// which is formatted by ws.ReadFromConnInto.
+func closeCode(data []byte) int {
+	s := string(data)
+	if i := strings.IndexByte(s, ':'); i != -1 {
+		s = s[:i]
+	}
+	code, err := strconv.Atoi(s)
+	if err != nil {
+		return closeAbnormal
+	}
+	return code
+}
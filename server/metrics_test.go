@@ -0,0 +1,110 @@
+package server
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/gobwas/gws/ws"
+)
+
+const metricsGolden = `# HELP gws_connections_active Number of active connections.
+# TYPE gws_connections_active gauge
+gws_connections_active 1
+# HELP gws_connections_total Number of established connections.
+# TYPE gws_connections_total counter
+gws_connections_total 3
+# HELP gws_messages_received_total Number of received messages by opcode.
+# TYPE gws_messages_received_total counter
+gws_messages_received_total{opcode="text"} 2
+gws_messages_received_total{opcode="binary"} 1
+# HELP gws_bytes_received_total Number of received payload bytes by opcode.
+# TYPE gws_bytes_received_total counter
+gws_bytes_received_total{opcode="text"} 8
+gws_bytes_received_total{opcode="binary"} 10
+# HELP gws_messages_sent_total Number of sent messages by opcode.
+# TYPE gws_messages_sent_total counter
+gws_messages_sent_total{opcode="text"} 1
+# HELP gws_bytes_sent_total Number of sent payload bytes by opcode.
+# TYPE gws_bytes_sent_total counter
+gws_bytes_sent_total{opcode="text"} 5
+# HELP gws_handshake_failures_total Number of failed handshakes by reason.
+# TYPE gws_handshake_failures_total counter
+gws_handshake_failures_total{reason="auth"} 2
+gws_handshake_failures_total{reason="not_found"} 1
+# HELP gws_close_codes_total Number of closed connections by close code.
+# TYPE gws_close_codes_total counter
+gws_close_codes_total{code="1001"} 1
+gws_close_codes_total{code="1006"} 1
+# HELP gws_stream_dropped_total Number of pushed messages dropped because of slow connections.
+# TYPE gws_stream_dropped_total counter
+gws_stream_dropped_total 4
+# HELP gws_response_latency_seconds Time between receiving message and sending response.
+# TYPE gws_response_latency_seconds histogram
+gws_response_latency_seconds_bucket{le="0.0005"} 0
+gws_response_latency_seconds_bucket{le="0.001"} 0
+gws_response_latency_seconds_bucket{le="0.0025"} 1
+gws_response_latency_seconds_bucket{le="0.005"} 1
+gws_response_latency_seconds_bucket{le="0.01"} 1
+gws_response_latency_seconds_bucket{le="0.025"} 1
+gws_response_latency_seconds_bucket{le="0.05"} 1
+gws_response_latency_seconds_bucket{le="0.1"} 1
+gws_response_latency_seconds_bucket{le="0.25"} 1
+gws_response_latency_seconds_bucket{le="0.5"} 2
+gws_response_latency_seconds_bucket{le="1"} 2
+gws_response_latency_seconds_bucket{le="2.5"} 2
+gws_response_latency_seconds_bucket{le="5"} 2
+gws_response_latency_seconds_bucket{le="10"} 2
+gws_response_latency_seconds_bucket{le="+Inf"} 3
+gws_response_latency_seconds_sum 20.502
+gws_response_latency_seconds_count 3
+`
+
+func TestMetricsWriteTo(t *testing.T) {
+	m := newMetrics()
+	for i := 0; i < 3; i++ {
+		m.connOpen()
+	}
+	m.connClose(closeCode([]byte("1001: going away")))
+	m.connClose(closeCode(nil))
+	m.handshakeFailure(failAuth)
+	m.handshakeFailure(failNotFound)
+	m.handshakeFailure(failAuth)
+	m.received(ws.BinaryMessage, 10)
+	m.received(ws.TextMessage, 3)
+	m.received(ws.TextMessage, 5)
+	m.sent(ws.TextMessage, 5)
+	m.streamDropped(4)
+	m.latency(2 * time.Millisecond)
+	m.latency(500 * time.Millisecond)
+	m.latency(20 * time.Second)
+
+	var buf bytes.Buffer
+	n, err := m.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("WriteTo() returned %d; want %d", n, buf.Len())
+	}
+	if act := buf.String(); act != metricsGolden {
+		t.Errorf("unexpected metrics:\n%s\nwant:\n%s", act, metricsGolden)
+	}
+}
+
+func TestCloseCode(t *testing.T) {
+	for _, test := range []struct {
+		data string
+		exp  int
+	}{
+		{"1000: ", 1000},
+		{"1008: policy violation", 1008},
+		{"4000", 4000},
+		{"", closeAbnormal},
+		{"garbage: 1000", closeAbnormal},
+	} {
+		if act := closeCode([]byte(test.data)); act != test.exp {
+			t.Errorf("closeCode(%q) = %d; want %d", test.data, act, test.exp)
+		}
+	}
+}
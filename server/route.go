@@ -0,0 +1,131 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/gobwas/glob"
+	"github.com/gobwas/gws/ws"
+)
+
+// Route describes handling of the requests with matching url path.
+type Route struct {
+	// Path is a glob pattern with "/" as separator. Note that "/admin/**"
+	// does not match "/admin"; use "{/admin,/admin/**}" to match both.
+	Path     string            `json:"path"`
+	Response string            `json:"response"`
+	Origin   string            `json:"origin,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty"`
+
+	// Auth is an authorization rule in format of ParseAuth.
+	// Config.Auth is used if it is empty.
+	Auth string `json:"auth,omitempty"`
+}
+
+// RouteList is a flag.Value that collects routes in format "path=response".
+type RouteList []Route
+
+func (r *RouteList) Set(s string) error {
+	i := strings.LastIndex(s, "=")
+	if i == -1 {
+		return fmt.Errorf("malformed route %q: expecting path=response", s)
+	}
+	*r = append(*r, Route{
+		Path:     strings.TrimSpace(s[:i]),
+		Response: strings.TrimSpace(s[i+1:]),
+	})
+	return nil
+}
+
+func (r RouteList) String() string {
+	var pairs []string
+	for _, route := range r {
+		pairs = append(pairs, route.Path+"="+route.Response)
+	}
+	return strings.Join(pairs, ", ")
+}
+
+// ReadRoutes reads json encoded list of routes from file.
+func ReadRoutes(file string) ([]Route, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var routes []Route
+	if err := json.Unmarshal(data, &routes); err != nil {
+		return nil, fmt.Errorf("malformed routes file %q: %s", file, err)
+	}
+	return routes, nil
+}
+
+type route struct {
+	path      string
+	pattern   glob.Glob
+	reject    bool
+	stream    bool
+	auth      Authorizer
+	responder Responder
+	upgrader  ws.Upgrader
+}
+
+func compileRoute(r Route, c Config) (*route, error) {
+	pattern, err := glob.Compile(r.Path, '/')
+	if err != nil {
+		return nil, fmt.Errorf("malformed route path %q: %s", r.Path, err)
+	}
+
+	ret := &route{
+		path:    r.Path,
+		pattern: pattern,
+	}
+	if r.Response == reject {
+		ret.reject = true
+		return ret, nil
+	}
+
+	if r.Response == stream {
+		// Connections of stream route ignore incoming messages.
+		ret.stream = true
+		ret.responder = DevNullResponder
+	} else {
+		ret.responder, err = getResponder(r.Response)
+		if err != nil {
+			return nil, fmt.Errorf("route %q: %s", r.Path, err)
+		}
+	}
+
+	ret.auth = c.Auth
+	if r.Auth != "" {
+		ret.auth, err = ParseAuth(r.Auth)
+		if err != nil {
+			return nil, fmt.Errorf("route %q: %s", r.Path, err)
+		}
+	}
+
+	origin := c.Origin
+	if r.Origin != "" {
+		origin = r.Origin
+	}
+	if origin != "" {
+		// Upgrader panics on malformed pattern.
+		if _, err := glob.Compile(origin); err != nil {
+			return nil, fmt.Errorf("route %q: malformed origin %q: %s", r.Path, origin, err)
+		}
+	}
+	headers := make(http.Header, len(c.Headers)+len(r.Headers))
+	for key, values := range c.Headers {
+		headers[key] = append([]string(nil), values...)
+	}
+	for key, value := range r.Headers {
+		headers.Set(key, value)
+	}
+	ret.upgrader = ws.GetUpgrader(ws.UpgradeConfig{
+		Origin:  origin,
+		Headers: headers,
+	})
+
+	return ret, nil
+}
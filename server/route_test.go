@@ -0,0 +1,145 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gobwas/gws/ws"
+)
+
+func TestRouteListSet(t *testing.T) {
+	for _, test := range []struct {
+		value string
+		route Route
+		err   bool
+	}{
+		{"/echo=echo", Route{Path: "/echo", Response: "echo"}, false},
+		{" /a/** = reject ", Route{Path: "/a/**", Response: "reject"}, false},
+		{"/q?a=b=null", Route{Path: "/q?a=b", Response: "null"}, false},
+		{"/echo", Route{}, true},
+	} {
+		var list RouteList
+		err := list.Set(test.value)
+		if (err != nil) != test.err {
+			t.Errorf("Set(%q) error is %v; want error %v", test.value, err, test.err)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(list, RouteList{test.route}) {
+			t.Errorf("Set(%q) = %+v; want %+v", test.value, list, test.route)
+		}
+	}
+}
+
+func TestReadRoutes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, test := range []struct {
+		name   string
+		data   string
+		routes []Route
+		err    bool
+	}{
+		{
+			name: "valid",
+			data: `[{"path": "/echo", "response": "echo", "headers": {"X-Route": "echo"}}, {"path": "/**", "response": "null", "origin": "*"}]`,
+			routes: []Route{
+				{Path: "/echo", Response: "echo", Headers: map[string]string{"X-Route": "echo"}},
+				{Path: "/**", Response: "null", Origin: "*"},
+			},
+		},
+		{name: "malformed", data: `{"path": "/echo"}`, err: true},
+		{name: "missing", err: true},
+	} {
+		file := filepath.Join(dir, test.name+".json")
+		if test.data != "" {
+			if err := ioutil.WriteFile(file, []byte(test.data), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		routes, err := ReadRoutes(file)
+		if (err != nil) != test.err {
+			t.Errorf("[%s] ReadRoutes() error is %v; want error %v", test.name, err, test.err)
+			continue
+		}
+		if !reflect.DeepEqual(routes, test.routes) {
+			t.Errorf("[%s] ReadRoutes() = %+v; want %+v", test.name, routes, test.routes)
+		}
+	}
+}
+
+func TestCompileRoute(t *testing.T) {
+	for _, test := range []struct {
+		route  Route
+		origin string
+		err    bool
+	}{
+		{route: Route{Path: "/echo", Response: echo}},
+		{route: Route{Path: "/admin/**", Response: reject}},
+		{route: Route{Path: "/feed", Response: stream}},
+		{route: Route{Path: "/[", Response: echo}, err: true},
+		{route: Route{Path: "/echo", Response: "unknown"}, err: true},
+		{route: Route{Path: "/echo", Response: echo, Auth: "unknown:x"}, err: true},
+		{route: Route{Path: "/echo", Response: echo, Origin: "http://[.example.com"}, err: true},
+		{route: Route{Path: "/echo", Response: echo}, origin: "http://[", err: true},
+		{route: Route{Path: "/echo", Response: echo, Origin: "*"}, origin: "http://["},
+	} {
+		_, err := compileRoute(test.route, Config{Origin: test.origin})
+		if (err != nil) != test.err {
+			t.Errorf("compileRoute(%+v) with origin %q error is %v; want error %v", test.route, test.origin, err, test.err)
+		}
+	}
+}
+
+func TestRouteMatch(t *testing.T) {
+	h, err := newWsHandler(Config{}, []Route{
+		{Path: "{/admin,/admin/**}", Response: reject},
+		{Path: "/echo", Response: echo, Headers: map[string]string{"X-Route": "echo"}},
+		{Path: "/*", Response: mirror},
+		{Path: "/**", Response: null},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		path  string
+		route string
+	}{
+		{"/admin", "{/admin,/admin/**}"},
+		{"/admin/users/1", "{/admin,/admin/**}"},
+		{"/echo", "/echo"},
+		{"/mirror", "/*"},
+		{"/a/b", "/**"},
+	} {
+		if r := h.match(test.path); r == nil || r.path != test.route {
+			t.Errorf("match(%q) = %+v; want route %q", test.path, r, test.route)
+		}
+	}
+
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+	addr := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	_, resp, err := ws.GetConn(addr+"/admin/x", nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("rejected route response is %v, %v; want %d status", resp, err, http.StatusForbidden)
+	}
+
+	conn, resp, err := ws.GetConn(addr+"/echo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if got := resp.Header.Get("X-Route"); got != "echo" {
+		t.Errorf("X-Route header is %q; want %q", got, "echo")
+	}
+}
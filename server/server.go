@@ -1,7 +1,6 @@
 package server
 
 import (
-	"errors"
 	"flag"
 	"fmt"
 	"github.com/chzyer/readline"
@@ -19,17 +18,35 @@ import (
 	"strconv"
 	"strings"
 	"sync"
-	"sync/atomic"
 	"time"
 )
 
 var (
-	origin    = flag.String("origin", "", "use this glob pattern for server origin checks")
-	responder = &ResponderFlag{null, []string{echo, mirror, prompt, null}}
+	origin     = flag.String("origin", "", "use this glob pattern for server origin checks")
+	responder  = &ResponderFlag{choice{null, []string{echo, mirror, prompt, stream, null}}}
+	authRule   = flag.String("auth", "", "require authorization on handshake\n\tformat:\n\t\t{ bearer:token | basic:user:password | header:name=value | query:name=value | hmac:secret | jwt:keyfile }")
+	authStatus = flag.Int("auth-status", 0, "status code of response on failed authorization (0 means 401 for missing and 403 for invalid credentials)")
+	authBody   = flag.String("auth-body", "", "body of response on failed authorization")
+	metricsURL = flag.String("metrics", "", "path to serve metrics in prometheus text format, e.g. /metrics (disabled by default)")
+	maxConns   = flag.Int("max-conns", 0, "maximum number of simultaneous connections (0 means no limit)")
+	maxConnsIP = flag.Int("max-conns-per-ip", 0, "maximum number of simultaneous connections from one ip (0 means no limit)")
+	rate       = flag.Float64("rate", 0, "maximum number of messages per second from one connection (0 means no limit)")
+	burst      = flag.Int("burst", 1, "number of messages that could exceed the rate limit at once")
+	rateAction = &RateActionFlag{choice{rateDrop, []string{rateDrop, rateDelay, rateClose}}}
+	routesFile = flag.String("routes", "", "path to json file with list of routes")
+	routeList  = &RouteList{}
+	streamMode = &StreamModeFlag{choice{streamInterval, []string{streamInterval, streamPoisson, streamFile}}}
+	streamRate = flag.Float64("stream-rate", 0, "target number of pushed messages per second for stream responder")
+	streamTick = flag.Duration("stream-interval", time.Second, "interval between pushed messages for stream responder in interval and poisson modes")
+	streamPath = flag.String("stream-file", "-", "path to file with lines to be pushed by stream responder in file mode (- is stdin)")
+	streamTmpl = flag.String("stream-template", "", "text/template of pushed messages for stream responder\n\tfields:\n\t\t{{.Seq}}, {{.Conn}}, {{.Time}}, {{.Line}}")
 )
 
 func init() {
 	flag.Var(responder, "response", fmt.Sprintf("how should server response on message (%s)", strings.Join(responder.expect, ", ")))
+	flag.Var(routeList, "route", fmt.Sprintf("route requests with path matching glob pattern to responder (%s, %s)\n\tformat:\n\t\t{ path = response }", strings.Join(responder.expect, ", "), reject))
+	flag.Var(streamMode, "stream-mode", fmt.Sprintf("schedule of pushed messages for stream responder (%s)", strings.Join(streamMode.expect, ", ")))
+	flag.Var(rateAction, "rate-action", fmt.Sprintf("what should server do with message that exceeds the rate limit (%s)", strings.Join(rateAction.expect, ", ")))
 }
 
 const (
@@ -37,28 +54,52 @@ const (
 	mirror = "mirror"
 	prompt = "prompt"
 	null   = "null"
+	stream = "stream"
+	reject = "reject"
 )
 
 func Go(c config.Config) error {
-	var r Responder
-	switch responder.Get() {
-	case echo:
-		r = EchoResponder
-	case mirror:
-		r = MirrorResponder
-	case prompt:
-		r = PromptResponder
-	case null:
-		r = DevNullResponder
-	default:
-		return errors.New("unknown responder type")
+	routes := []Route(*routeList)
+	if *routesFile != "" {
+		fromFile, err := ReadRoutes(*routesFile)
+		if err != nil {
+			return err
+		}
+		routes = append(routes, fromFile...)
+	}
+	if len(routes) == 0 {
+		routes = []Route{{Path: "**", Response: responder.Get().(string)}}
+	}
+
+	var auth Authorizer
+	if *authRule != "" {
+		var err error
+		if auth, err = ParseAuth(*authRule); err != nil {
+			return err
+		}
 	}
 
 	handler, err := newWsHandler(Config{
-		Headers:  c.Headers,
-		Origin:   *origin,
-		StatDump: c.StatDump,
-	}, r)
+		Headers:       c.Headers,
+		Origin:        *origin,
+		StatDump:      c.StatDump,
+		MetricsPath:   *metricsURL,
+		Auth:          auth,
+		AuthStatus:    *authStatus,
+		AuthBody:      *authBody,
+		MaxConns:      *maxConns,
+		MaxConnsPerIP: *maxConnsIP,
+		Rate:          *rate,
+		Burst:         *burst,
+		RateAction:    rateAction.Get().(string),
+		Stream: StreamConfig{
+			Mode:     streamMode.Get().(string),
+			Rate:     *streamRate,
+			Interval: *streamTick,
+			File:     *streamPath,
+			Template: *streamTmpl,
+		},
+	}, routes)
 	if err != nil {
 		return err
 	}
@@ -69,24 +110,64 @@ func Go(c config.Config) error {
 	return http.ListenAndServe(c.Addr, handler)
 }
 
+func getResponder(name string) (Responder, error) {
+	switch name {
+	case echo:
+		return EchoResponder, nil
+	case mirror:
+		return MirrorResponder, nil
+	case prompt:
+		return PromptResponder, nil
+	case null:
+		return DevNullResponder, nil
+	default:
+		return nil, fmt.Errorf("unknown responder type: %q", name)
+	}
+}
+
 type wsHandler struct {
 	mu sync.Mutex
 
-	upgrader   ws.Upgrader
+	routes     []*route
+	limiter    *connLimiter
+	streamer   *streamer
+	metrics    *metrics
 	config     Config
-	responder  Responder
 	sig        chan os.Signal
 	nextID     uint64
 	connsCount uint64
 	conns      map[uint64]connDescriptor
-
-	requests uint64
 }
 
 type Config struct {
 	Headers  http.Header
 	Origin   string
 	StatDump time.Duration
+
+	// Auth is used to authorize handshake requests if it is not nil.
+	// AuthStatus and AuthBody configure response on failed authorization.
+	Auth       Authorizer
+	AuthStatus int
+	AuthBody   string
+
+	// MetricsPath is a path to serve metrics on.
+	// Empty string disables metrics handler.
+	MetricsPath string
+
+	// MaxConns and MaxConnsPerIP limit the number of simultaneous
+	// connections. Zero value means no limit.
+	MaxConns      int
+	MaxConnsPerIP int
+
+	// Rate and Burst configure token bucket for the incoming messages of
+	// each connection. RateAction is the one of "drop", "delay" or "close".
+	Rate       float64
+	Burst      int
+	RateAction string
+
+	// Stream configures pushing messages to the connections of routes with
+	// "stream" responder.
+	Stream StreamConfig
 }
 
 type connDescriptor struct {
@@ -99,14 +180,38 @@ const headerOrigin = "Origin"
 
 type Responder func(ws.Kind, []byte) ([]byte, error)
 
-func newWsHandler(c Config, r Responder) (*wsHandler, error) {
-	return &wsHandler{
-		upgrader:  ws.GetUpgrader(ws.UpgradeConfig{c.Origin, c.Headers}),
-		config:    c,
-		responder: r,
-		sig:       make(chan os.Signal, 1),
-		conns:     make(map[uint64]connDescriptor),
-	}, nil
+func newWsHandler(c Config, routes []Route) (*wsHandler, error) {
+	h := &wsHandler{
+		limiter: newConnLimiter(c.MaxConns, c.MaxConnsPerIP),
+		metrics: newMetrics(),
+		config:  c,
+		sig:     make(chan os.Signal, 1),
+		conns:   make(map[uint64]connDescriptor),
+	}
+	for _, r := range routes {
+		route, err := compileRoute(r, c)
+		if err != nil {
+			return nil, err
+		}
+		h.routes = append(h.routes, route)
+
+		if route.stream && h.streamer == nil {
+			h.streamer, err = newStreamer(c.Stream)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return h, nil
+}
+
+func (h *wsHandler) match(path string) *route {
+	for _, r := range h.routes {
+		if r.pattern.Match(path) {
+			return r
+		}
+	}
+	return nil
 }
 
 func (h *wsHandler) Init() {
@@ -124,7 +229,7 @@ func (h *wsHandler) Init() {
 				if h.connsCount > 1 {
 					var items []readline.PrefixCompleterInterface
 					for id := range h.conns {
-						items = append(items, readline.PcItem(string(id)))
+						items = append(items, readline.PcItem(strconv.FormatUint(id, 10)))
 					}
 					completer := readline.NewPrefixCompleter(items...)
 
@@ -168,10 +273,19 @@ func (h *wsHandler) Init() {
 		}
 	}()
 
+	if h.streamer != nil {
+		go h.streamer.run()
+	}
+
 	go func() {
+		prev := h.metrics.snapshot()
 		for range time.Tick(h.config.StatDump) {
-			v := atomic.SwapUint64(&h.requests, 0)
-			log.Printf("RPS: (%d) %.2f\n", v, float64(v/uint64(h.config.StatDump.Seconds())))
+			if h.streamer != nil {
+				h.metrics.streamDropped(h.streamer.Dropped())
+			}
+			cur := h.metrics.snapshot()
+			log.Println(cur.String(prev))
+			prev = cur
 		}
 	}()
 }
@@ -186,14 +300,57 @@ func (h *wsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		log.Println("new request", string(req))
 	}
 
+	if h.config.MetricsPath != "" && r.URL.Path == h.config.MetricsPath {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		h.metrics.WriteTo(w)
+		return
+	}
+
+	route := h.match(r.URL.Path)
+	if route == nil {
+		h.metrics.handshakeFailure(failNotFound)
+		http.NotFound(w, r)
+		return
+	}
+	if route.reject {
+		h.metrics.handshakeFailure(failRejected)
+		log.Printf("rejected request to %q by route %q\n", r.URL.Path, route.path)
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	var identity string
+	if route.auth != nil {
+		var err error
+		identity, err = route.auth.Authorize(r)
+		if err != nil {
+			h.metrics.handshakeFailure(failAuth)
+			log.Printf("unauthorized request from %q to %q: %s\n", r.RemoteAddr, r.URL.Path, err)
+			writeAuthError(w, route.auth, err, h.config.AuthStatus, h.config.AuthBody)
+			return
+		}
+	}
+
+	ip := remoteIP(r)
+	if err := h.limiter.acquire(ip); err != nil {
+		h.metrics.handshakeFailure(failLimit)
+		log.Printf("rejected connection from %q: %s\n", r.RemoteAddr, err)
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer h.limiter.release(ip)
+
 	// take lock on read new connection
 	h.mu.Lock()
-	conn, err := h.upgrader(w, r)
+	conn, err := route.upgrader(w, r)
 	if err != nil {
+		h.metrics.handshakeFailure(failUpgrade)
 		log.Println(err)
 		h.mu.Unlock()
 		return
 	}
+	h.metrics.connOpen()
+	code := closeAbnormal
 	h.connsCount++
 	h.nextID++
 	id := h.nextID
@@ -209,18 +366,29 @@ func (h *wsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		delete(h.conns, id)
 		h.connsCount--
 		h.mu.Unlock()
+		h.metrics.connClose(code)
 
 		if config.Verbose {
-			log.Printf("connection #%d closed\n", id)
+			log.Printf("connection #%d %s closed\n", id, identity)
 		}
 	}()
 	h.mu.Unlock()
 
+	if identity != "" {
+		log.Printf("connection #%d from %q authorized as %q\n", id, r.RemoteAddr, identity)
+	}
 	if config.Verbose {
-		log.Printf("establised connection #%d from %q\n", id, r.RemoteAddr)
+		log.Printf("establised connection #%d from %q to %q\n", id, r.RemoteAddr, r.URL.Path)
+	}
+
+	var push <-chan []byte
+	if route.stream {
+		push = h.streamer.subscribe(id)
+		defer h.streamer.unsubscribe(id)
 	}
 
 	in := ws.ReadAsyncFromConn(desc.done, conn)
+	limit := newBucket(h.config.Rate, h.config.Burst)
 
 	for {
 		select {
@@ -233,10 +401,22 @@ func (h *wsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				log.Println("error reading from socket:", err)
 				return
 			}
+			h.metrics.sent(ws.TextMessage, len(notice))
 			log.Printf("sent message to %d: %s\n", id, string(notice))
 
+		case msg := <-push:
+			err := ws.WriteToConn(conn, ws.TextMessage, msg)
+			if err != nil {
+				log.Println("error writing to socket:", err)
+				return
+			}
+			h.metrics.sent(ws.TextMessage, len(msg))
+			if config.Verbose {
+				log.Printf("pushed message to %d: %s\n", id, string(msg))
+			}
+
 		case msg := <-in:
-			atomic.AddUint64(&h.requests, 1)
+			received := time.Now()
 
 			if msg.Err != nil {
 				if msg.Err != io.EOF {
@@ -245,12 +425,44 @@ func (h *wsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 				return
 			}
+			h.metrics.received(msg.Kind, len(msg.Data))
+
+			switch msg.Kind {
+			case ws.CloseMessage:
+				code = closeCode(msg.Data)
+				continue
+			case ws.PingMessage, ws.PongMessage:
+				continue
+			}
 			if config.Verbose {
 				log.Printf("received message from %d: %s\n", id, string(msg.Data))
 			}
 
+			switch h.config.RateAction {
+			case rateDelay:
+				time.Sleep(limit.reserve())
+			case rateClose:
+				if !limit.allow() {
+					log.Printf("closing connection #%d: rate limit exceeded\n", id)
+					code = websocket.ClosePolicyViolation
+					conn.WriteControl(
+						websocket.CloseMessage,
+						websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "rate limit exceeded"),
+						time.Now().Add(time.Second),
+					)
+					return
+				}
+			default:
+				if !limit.allow() {
+					if config.Verbose {
+						log.Printf("dropped message from %d: rate limit exceeded\n", id)
+					}
+					continue
+				}
+			}
+
 			h.mu.Lock()
-			resp, err := h.responder(msg.Kind, msg.Data)
+			resp, err := route.responder(msg.Kind, msg.Data)
 			h.mu.Unlock()
 			if err != nil {
 				log.Println("responder error:", err)
@@ -263,6 +475,8 @@ func (h *wsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 					log.Println(err)
 					return
 				}
+				h.metrics.sent(msg.Kind, len(resp))
+				h.metrics.latency(time.Since(received))
 
 				if config.Verbose {
 					log.Printf("sent message to %d: %s\n", id, string(resp))
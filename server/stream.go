@@ -0,0 +1,221 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/gobwas/gws/config"
+)
+
+const (
+	streamInterval = "interval"
+	streamPoisson  = "poisson"
+	streamFile     = "file"
+)
+
+// streamBuffer is a number of pushed messages that could wait for write in
+// each connection. Messages that do not fit into buffer are dropped.
+const streamBuffer = 256
+
+// StreamConfig describes schedule and payload of server-push streaming.
+type StreamConfig struct {
+	// Mode is the one of "interval", "poisson" or "file".
+	Mode string
+
+	// Rate is a target number of messages per second. If it is zero,
+	// Interval is used for "interval" and "poisson" modes; and lines are
+	// sent as soon as they are read in "file" mode, which ignores Interval.
+	Rate     float64
+	Interval time.Duration
+
+	// File is a path to file with lines to be sent in "file" mode.
+	// Stdin is used if it is "-".
+	File string
+
+	// Template is a text/template for the payload.
+	// It is executed with StreamMessage as data.
+	Template string
+}
+
+// StreamMessage is passed to the stream payload template.
+type StreamMessage struct {
+	Seq  uint64
+	Conn uint64
+	Time time.Time
+	Line string
+}
+
+type streamer struct {
+	mu      sync.Mutex
+	once    sync.Once
+	ready   chan struct{}
+	config  StreamConfig
+	tmpl    *template.Template
+	conns   map[uint64]chan []byte
+	seq     uint64
+	dropped uint64
+}
+
+func newStreamer(c StreamConfig) (*streamer, error) {
+	switch c.Mode {
+	case streamInterval, streamPoisson:
+		if c.Rate <= 0 && c.Interval <= 0 {
+			return nil, fmt.Errorf("stream rate or interval should be positive")
+		}
+	case streamFile:
+		if c.File == "" {
+			return nil, fmt.Errorf("stream file is required for %q mode", streamFile)
+		}
+	default:
+		return nil, fmt.Errorf("unknown stream mode: %q", c.Mode)
+	}
+
+	text := c.Template
+	if text == "" {
+		if c.Mode == streamFile {
+			text = "{{.Line}}"
+		} else {
+			text = "{{.Seq}}"
+		}
+	}
+	tmpl, err := template.New("stream").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("malformed stream template: %s", err)
+	}
+
+	return &streamer{
+		config: c,
+		tmpl:   tmpl,
+		ready:  make(chan struct{}),
+		conns:  make(map[uint64]chan []byte),
+	}, nil
+}
+
+func (s *streamer) subscribe(id uint64) <-chan []byte {
+	ch := make(chan []byte, streamBuffer)
+	s.mu.Lock()
+	s.conns[id] = ch
+	s.mu.Unlock()
+	s.once.Do(func() { close(s.ready) })
+	return ch
+}
+
+func (s *streamer) unsubscribe(id uint64) {
+	s.mu.Lock()
+	delete(s.conns, id)
+	s.mu.Unlock()
+}
+
+// Dropped returns number of messages that were dropped since the last call
+// because of slow connections.
+func (s *streamer) Dropped() uint64 {
+	return atomic.SwapUint64(&s.dropped, 0)
+}
+
+func (s *streamer) run() {
+	switch s.config.Mode {
+	case streamFile:
+		s.runFile()
+	default:
+		last := time.Now()
+		for {
+			last = s.wait(last)
+			s.push("")
+		}
+	}
+}
+
+func (s *streamer) runFile() {
+	// Do not lose lines while there are no connections.
+	<-s.ready
+
+	var r io.Reader
+	if s.config.File == "-" {
+		r = os.Stdin
+	} else {
+		f, err := os.Open(s.config.File)
+		if err != nil {
+			log.Println("stream error:", err)
+			return
+		}
+		defer f.Close()
+		r = f
+	}
+
+	scanner := bufio.NewScanner(r)
+	last := time.Now()
+	for scanner.Scan() {
+		if s.config.Rate > 0 {
+			last = s.wait(last)
+		}
+		s.push(scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		log.Println("stream error:", err)
+		return
+	}
+	log.Println("stream file is over")
+}
+
+// wait sleeps until the deadline of the next message, which is the deadline of
+// the last one plus delay, so time spent on sending does not lower the rate.
+// Missed deadlines are not caught up, like when there was no line to read, to
+// not to send a burst of messages. It returns the deadline.
+func (s *streamer) wait(last time.Time) time.Time {
+	next := last.Add(s.delay())
+	if d := time.Until(next); d > 0 {
+		time.Sleep(d)
+		return next
+	}
+	return time.Now()
+}
+
+func (s *streamer) delay() time.Duration {
+	period := s.config.Interval
+	if s.config.Rate > 0 {
+		period = time.Duration(float64(time.Second) / s.config.Rate)
+	}
+	if s.config.Mode == streamPoisson {
+		return time.Duration(rand.ExpFloat64() * float64(period))
+	}
+	return period
+}
+
+func (s *streamer) push(line string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq++
+	now := time.Now()
+	for id, ch := range s.conns {
+		buf := &bytes.Buffer{}
+		err := s.tmpl.Execute(buf, StreamMessage{
+			Seq:  s.seq,
+			Conn: id,
+			Time: now,
+			Line: line,
+		})
+		if err != nil {
+			log.Println("stream template error:", err)
+			return
+		}
+
+		select {
+		case ch <- buf.Bytes():
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+			if config.Verbose {
+				log.Printf("dropped pushed message to %d: connection is too slow\n", id)
+			}
+		}
+	}
+}
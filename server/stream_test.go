@@ -0,0 +1,62 @@
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestStreamWait(t *testing.T) {
+	s, err := newStreamer(StreamConfig{Mode: streamInterval, Rate: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Time spent since the last deadline is subtracted from the delay.
+	last := time.Now().Add(-5 * time.Millisecond)
+	if next := s.wait(last); !next.Equal(last.Add(10 * time.Millisecond)) {
+		t.Errorf("wait() = %v after the last deadline; want 10ms", next.Sub(last))
+	}
+	if time.Now().Before(last.Add(10 * time.Millisecond)) {
+		t.Errorf("wait() returned before the deadline")
+	}
+
+	// Missed deadlines are not caught up.
+	last = time.Now().Add(-time.Second)
+	if next := s.wait(last); time.Since(next) > 100*time.Millisecond {
+		t.Errorf("wait() = %v after the last deadline; want now", next.Sub(last))
+	}
+}
+
+func TestStreamFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "gws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("a\nb\nc\n")
+	f.Close()
+
+	// Interval does not throttle file mode.
+	s, err := newStreamer(StreamConfig{Mode: streamFile, File: f.Name(), Interval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := s.subscribe(1)
+	done := make(chan struct{})
+	go func() {
+		s.run()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("file is not sent in time")
+	}
+	for _, want := range []string{"a", "b", "c"} {
+		if got := string(<-ch); got != want {
+			t.Errorf("got message %q; want %q", got, want)
+		}
+	}
+}
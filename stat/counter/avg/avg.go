@@ -45,6 +45,16 @@ func (a *Avg) Flush() (result float64) {
 	return
 }
 
+// Count returns number of added values.
+func (a *Avg) Count() (result float64) {
+	a.mu.Lock()
+	{
+		result = a.count
+	}
+	a.mu.Unlock()
+	return
+}
+
 func (a *Avg) Kind() string {
 	return "avg"
 }
@@ -0,0 +1,50 @@
+package results
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Merge merges results of the same counters from multiple sources, such as
+// processes running the same script. Averages are weighted by their counts;
+// other values are summed.
+func Merge(lists ...[]Result) []Result {
+	var (
+		merged []Result
+		index  = make(map[string]int)
+	)
+	for _, list := range lists {
+		for _, r := range list {
+			k := key(r)
+			i, ok := index[k]
+			if !ok {
+				index[k] = len(merged)
+				merged = append(merged, r)
+				continue
+			}
+			m := &merged[i]
+			if r.Kind == "avg" {
+				if count := m.Count + r.Count; count > 0 {
+					m.Value = (m.Value*m.Count + r.Value*r.Count) / count
+				}
+			} else {
+				m.Value += r.Value
+			}
+			m.Count += r.Count
+		}
+	}
+	return merged
+}
+
+func key(r Result) string {
+	var pairs []string
+	for k, v := range r.Tags {
+		pairs = append(pairs, "tag:"+k+"="+v)
+	}
+	for k, v := range r.Meta {
+		pairs = append(pairs, fmt.Sprintf("meta:%s=%v", k, v))
+	}
+	sort.Strings(pairs)
+	return r.Name + "\x00" + r.Kind + "\x00" + strings.Join(pairs, "\x00")
+}
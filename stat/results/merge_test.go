@@ -0,0 +1,35 @@
+package results
+
+import "testing"
+
+func TestMerge(t *testing.T) {
+	a := []Result{
+		{Name: "errors", Kind: "abs", Value: 2},
+		{Name: "latency", Kind: "avg", Value: 10, Count: 3},
+		{Name: "latency", Kind: "avg", Value: 1, Count: 1, Tags: map[string]string{"op": "send"}},
+	}
+	b := []Result{
+		{Name: "latency", Kind: "avg", Value: 30, Count: 1},
+		{Name: "errors", Kind: "abs", Value: 3},
+		{Name: "vus", Kind: "abs", Value: 5},
+	}
+	exp := map[string]float64{
+		"errors":       5,
+		"latency":      15,
+		"latency/send": 1,
+		"vus":          5,
+	}
+	merged := Merge(a, b)
+	if len(merged) != len(exp) {
+		t.Fatalf("merged %d results; want %d", len(merged), len(exp))
+	}
+	for _, r := range merged {
+		name := r.Name
+		if op, ok := r.Tags["op"]; ok {
+			name += "/" + op
+		}
+		if r.Value != exp[name] {
+			t.Errorf("%s = %v; want %v", name, r.Value, exp[name])
+		}
+	}
+}
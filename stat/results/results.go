@@ -6,4 +6,8 @@ type Result struct {
 	Value float64
 	Tags  map[string]string
 	Meta  map[string]interface{}
+
+	// Count is a number of values added to "avg" counter. It is used to
+	// merge averages.
+	Count float64
 }
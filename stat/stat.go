@@ -56,24 +56,46 @@ func New() *Statistics {
 }
 
 func (s *Statistics) Pretty() string {
+	return Pretty(s.Results())
+}
+
+// Results returns current values of all counters.
+func (s *Statistics) Results() (rs []results.Result) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	report := report.New()
 	for name, metrics := range s.Metrics {
 		for _, metric := range metrics {
 			for _, instance := range metric.Instances {
-				report.AddResult(results.Result{
+				r := results.Result{
 					Name:  name,
 					Kind:  instance.Counter.Kind(),
 					Value: instance.Counter.Flush(),
 					Tags:  metric.Tags,
 					Meta:  instance.Meta,
-				})
+				}
+				if c, ok := instance.Counter.(counted); ok {
+					r.Count = c.Count()
+				}
+				rs = append(rs, r)
 			}
 		}
 	}
+	return rs
+}
+
+// counted is implemented by counters which value could not be merged without
+// number of added values.
+type counted interface {
+	Count() float64
+}
 
+// Pretty returns report of the results as a table.
+func Pretty(rs []results.Result) string {
+	report := report.New()
+	for _, r := range rs {
+		report.AddResult(r)
+	}
 	return report.String()
 }
 
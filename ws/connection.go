@@ -4,8 +4,12 @@ import (
 	"errors"
 	"github.com/gorilla/websocket"
 	"sync"
+	"time"
 )
 
+// controlTimeout is a deadline for writing control frames.
+const controlTimeout = time.Second
+
 type Connection struct {
 	once sync.Once
 
@@ -46,6 +50,59 @@ func (c *Connection) Receive() (MessageRaw, error) {
 	return result.Message, result.Error
 }
 
+// Ping sends ping control frame with given data.
+func (c *Connection) Ping(data []byte) error {
+	return c.conn.WriteControl(PingMessage, data, time.Now().Add(controlTimeout))
+}
+
+// CloseWithCode sends close control frame with given code and reason and
+// then closes the connection.
+func (c *Connection) CloseWithCode(code int, reason string) error {
+	select {
+	case <-c.done:
+		return errors.New("already closed")
+	default:
+	}
+	msg := websocket.FormatCloseMessage(code, reason)
+	if err := c.conn.WriteControl(CloseMessage, msg, time.Now().Add(controlTimeout)); err != nil {
+		c.Close()
+		return err
+	}
+	return c.Close()
+}
+
+// OnPing sets fn to be called on every received ping frame.
+// Pong is still sent in reply.
+// Control frames are handled only while connection is receiving messages.
+// OnPing should be called before receiving is started.
+func (c *Connection) OnPing(fn func([]byte)) {
+	h := c.conn.PingHandler()
+	c.conn.SetPingHandler(func(data string) error {
+		fn([]byte(data))
+		return h(data)
+	})
+}
+
+// OnPong sets fn to be called on every received pong frame.
+// The same restrictions as for OnPing are applied.
+func (c *Connection) OnPong(fn func([]byte)) {
+	h := c.conn.PongHandler()
+	c.conn.SetPongHandler(func(data string) error {
+		fn([]byte(data))
+		return h(data)
+	})
+}
+
+// OnClose sets fn to be called on received close frame.
+// The same restrictions as for OnPing are applied.
+func (c *Connection) OnClose(fn func(code int, reason string)) {
+	h := c.conn.CloseHandler()
+	c.conn.SetCloseHandler(func(code int, reason string) error {
+		fn(code, reason)
+		return h(code, reason)
+	})
+}
+
 func (c *Connection) Done() <-chan struct{} {
 	return c.done
 }
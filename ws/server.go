@@ -35,15 +35,23 @@ type Server struct {
 	deferreds []func()
 	handlers  []Handler
 	conns     chan conn
+	ready     chan struct{}
 }
 
 func NewServer(cfg ServerConfig) *Server {
 	return &Server{
 		config: cfg,
 		conns:  make(chan conn),
+		ready:  make(chan struct{}),
 	}
 }
 
+// Ready returns channel which is closed when server starts accepting
+// connections or fails to listen.
+func (s *Server) Ready() <-chan struct{} {
+	return s.ready
+}
+
 func (s *Server) Handle(h Handler) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -81,6 +89,7 @@ func (s *Server) Listen(done chan struct{}) {
 		} else {
 			ln, err = getListener(done, s.config.Addr)
 		}
+		close(s.ready)
 
 		if err == nil {
 			err = http.Serve(ln, handler)
@@ -201,6 +201,12 @@ func ReadAsyncFromConn(done <-chan struct{}, conn *websocket.Conn) <-chan Messag
 }
 
 func GetConn(uri string, h http.Header) (conn *websocket.Conn, resp *http.Response, err error) {
+	return GetConnWithJar(uri, h, nil)
+}
+
+// GetConnWithJar is like GetConn but uses jar to send and store cookies
+// during handshake.
+func GetConnWithJar(uri string, h http.Header, jar http.CookieJar) (conn *websocket.Conn, resp *http.Response, err error) {
 	dialer := &websocket.Dialer{
 		NetDial: func(network, addr string) (net.Conn, error) {
 			netDialer := &net.Dialer{
@@ -208,14 +214,22 @@ func GetConn(uri string, h http.Header) (conn *websocket.Conn, resp *http.Respon
 			}
 			return netDialer.Dial(network, addr)
 		},
+		TLSClientConfig: TLSClientConfig(),
+		Jar:             jar,
 	}
+	conn, resp, err = dialer.Dial(uri, h)
+	return
+}
+
+// TLSClientConfig returns tls config for dialing with respect to -insecure
+// flag. It returns nil if default config should be used.
+func TLSClientConfig() *tls.Config {
 	if *insecure {
-		dialer.TLSClientConfig = &tls.Config{
+		return &tls.Config{
 			InsecureSkipVerify: true,
 		}
 	}
-	conn, resp, err = dialer.Dial(uri, h)
-	return
+	return nil
 }
 
 type UpgradeConfig struct {